@@ -0,0 +1,247 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 10000
+	defaultFlushInterval = time.Second
+	defaultFlushTimeout  = 30 * time.Second
+	defaultFlushRetries  = 3
+	flushRetryBackoff    = time.Second
+)
+
+var (
+	ErrBatchWriterClosed = errors.New("clickhouse batch writer is closed")
+	// errRowRejected marks rows that fail to append, retrying does not help.
+	errRowRejected = errors.New("row rejected")
+)
+
+// BatchStats counts rows: Failed could not be inserted after all retries,
+// Dropped are the failed rows that no OnError received.
+type BatchStats struct {
+	Buffered  int64  `json:"buffered"`
+	Flushed   int64  `json:"flushed"`
+	Retried   int64  `json:"retried"`
+	Failed    int64  `json:"failed"`
+	Dropped   int64  `json:"dropped"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// BatchWriter buffers structs per table and inserts them with PrepareBatch
+// once BatchSize rows are collected or FlushInterval passes. Write blocks
+// while MaxBuffered rows of a table are waiting to be flushed.
+type BatchWriter struct {
+	client *Client
+	cfg    BatchConfig
+
+	mt     sync.RWMutex
+	tables map[string]*tableWriter
+	closed bool
+	wg     sync.WaitGroup
+
+	buffered  atomic.Int64
+	flushed   atomic.Int64
+	retried   atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	lastError atomic.Value
+}
+
+type tableWriter struct {
+	table string
+	rows  chan any
+}
+
+// BatchWriter creates a writer that is flushed before the client is closed.
+func (c *Client) BatchWriter(cfg BatchConfig) *BatchWriter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.MaxBuffered < cfg.BatchSize {
+		cfg.MaxBuffered = cfg.BatchSize * 2
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = defaultFlushTimeout
+	}
+	if cfg.FlushRetries == 0 {
+		cfg.FlushRetries = defaultFlushRetries
+	}
+	writer := &BatchWriter{
+		client: c,
+		cfg:    cfg,
+		tables: map[string]*tableWriter{},
+	}
+	c.mt.Lock()
+	c.writers = append(c.writers, writer)
+	c.mt.Unlock()
+	return writer
+}
+
+// Write buffers rows for table. Rows are structs (or pointers to structs)
+// with `ch` tags matching the table columns.
+func (w *BatchWriter) Write(ctx context.Context, table string, rows ...any) error {
+	if err := w.ensureTable(table); err != nil {
+		return err
+	}
+	w.mt.RLock()
+	defer w.mt.RUnlock()
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	tw := w.tables[table]
+	for _, row := range rows {
+		select {
+		case tw.rows <- row:
+			w.buffered.Add(1)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (w *BatchWriter) ensureTable(table string) error {
+	w.mt.RLock()
+	_, ok := w.tables[table]
+	closed := w.closed
+	w.mt.RUnlock()
+	if closed {
+		return ErrBatchWriterClosed
+	}
+	if ok {
+		return nil
+	}
+	w.mt.Lock()
+	defer w.mt.Unlock()
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	if _, ok := w.tables[table]; !ok {
+		tw := &tableWriter{
+			table: table,
+			rows:  make(chan any, w.cfg.MaxBuffered),
+		}
+		w.tables[table] = tw
+		w.wg.Add(1)
+		go w.run(tw)
+	}
+	return nil
+}
+
+func (w *BatchWriter) run(tw *tableWriter) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]any, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case row, ok := <-tw.rows:
+			if !ok {
+				w.flush(tw.table, batch)
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) >= w.cfg.BatchSize {
+				w.flush(tw.table, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(tw.table, batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush retries a failed insert FlushRetries times with a doubling backoff,
+// Write blocks meanwhile once MaxBuffered rows wait.
+func (w *BatchWriter) flush(table string, rows []any) {
+	if len(rows) == 0 {
+		return
+	}
+	err := w.sendTimeout(table, rows)
+	backoff := flushRetryBackoff
+	for attempt := 0; err != nil && attempt < w.cfg.FlushRetries && !errors.Is(err, errRowRejected); attempt++ {
+		w.lastError.Store(err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+		w.retried.Add(int64(len(rows)))
+		err = w.sendTimeout(table, rows)
+	}
+	w.buffered.Add(-int64(len(rows)))
+	if err != nil {
+		w.failed.Add(int64(len(rows)))
+		w.lastError.Store(err.Error())
+		if w.cfg.OnError == nil {
+			w.dropped.Add(int64(len(rows)))
+			return
+		}
+		w.cfg.OnError(table, append([]any(nil), rows...), err)
+		return
+	}
+	w.flushed.Add(int64(len(rows)))
+}
+
+func (w *BatchWriter) sendTimeout(table string, rows []any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.FlushTimeout)
+	defer cancel()
+	return w.send(ctx, table, rows)
+}
+
+func (w *BatchWriter) send(ctx context.Context, table string, rows []any) error {
+	if w.client.Db == nil {
+		return w.client.Init.Error
+	}
+	batch, err := w.client.Db.PrepareBatch(ctx, "INSERT INTO "+table)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := batch.AppendStruct(row); err != nil {
+			_ = batch.Abort()
+			return fmt.Errorf("append to %s: %w: %w", table, errRowRejected, err)
+		}
+	}
+	return batch.Send()
+}
+
+func (w *BatchWriter) Stats() BatchStats {
+	stats := BatchStats{
+		Buffered: w.buffered.Load(),
+		Flushed:  w.flushed.Load(),
+		Retried:  w.retried.Load(),
+		Failed:   w.failed.Load(),
+		Dropped:  w.dropped.Load(),
+	}
+	if lastError, ok := w.lastError.Load().(string); ok {
+		stats.LastError = lastError
+	}
+	return stats
+}
+
+// Close flushes buffered rows and stops accepting writes.
+func (w *BatchWriter) Close() error {
+	w.mt.Lock()
+	if w.closed {
+		w.mt.Unlock()
+		return nil
+	}
+	w.closed = true
+	for _, tw := range w.tables {
+		close(tw.rows)
+	}
+	w.mt.Unlock()
+	w.wg.Wait()
+	return nil
+}
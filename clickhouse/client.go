@@ -6,28 +6,48 @@ import (
 	"github.com/ihatiko/go-chef-core-sdk/store"
 	"github.com/ihatiko/go-chef-core-sdk/types"
 	"net"
+	"sync"
 	"time"
 )
 
 type Client struct {
 	types.Component
-	config Config
-	Db     clickhouse.Conn
+	config   Config
+	Db       clickhouse.Conn
+	migrator *Migrator
+	mt       sync.Mutex
+	writers  []*BatchWriter
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.config.Name == "" {
+		return key
+	}
+	return key + "." + c.config.Name
 }
 
 type Details struct {
-	Database string `json:"database"`
-	Host     string `json:"host"`
+	Name       string            `json:"name,omitempty"`
+	Database   string            `json:"database"`
+	Host       string            `json:"host"`
+	Migrations *MigrationDetails `json:"migrations,omitempty"`
+	Batches    []BatchStats      `json:"batches,omitempty"`
 }
 
 func (c *Client) Details() any {
 	details := new(Details)
+	details.Name = c.config.Name
 	details.Database = c.config.Database
 	details.Host = c.config.Login
+	if c.migrator != nil {
+		migrations := c.migrator.details()
+		details.Migrations = &migrations
+	}
+	c.mt.Lock()
+	for _, writer := range c.writers {
+		details.Batches = append(details.Batches, writer.Stats())
+	}
+	c.mt.Unlock()
 	return details
 }
 
@@ -40,6 +60,12 @@ const (
 )
 
 func (c *Client) Shutdown() error {
+	c.mt.Lock()
+	writers := c.writers
+	c.mt.Unlock()
+	for _, writer := range writers {
+		_ = writer.Close()
+	}
 	return c.Db.Close()
 }
 
@@ -95,9 +121,34 @@ func (c Config) New() *Client {
 		return client
 	}
 	client.Db = conn
+	if c.AutoMigrate {
+		if err := client.migrate(); err != nil {
+			client.Init.Error = err
+			store.PackageStore.Load(client)
+			return client
+		}
+	}
 	client.Ping(c.DialTimeout, client.Live)
 	return client
 }
+
+// Migrator returns the migrator configured by AutoMigrate, or nil.
+func (c *Client) Migrator() *Migrator {
+	return c.migrator
+}
+
+func (c *Client) migrate() error {
+	source, err := c.config.migrationSource()
+	if err != nil {
+		return err
+	}
+	migrator, err := NewMigrator(c.Db, c.config.MigrationsTable, c.config.Cluster, source)
+	if err != nil {
+		return err
+	}
+	c.migrator = migrator
+	return migrator.Up(context.Background())
+}
 func (c *Client) Connection() clickhouse.Conn {
 	defer store.PackageStore.Load(c)
 	c.AwaitPing()
@@ -1,10 +1,13 @@
 package clickhouse
 
 import (
+	"io/fs"
 	"time"
 )
 
 type Config struct {
+	Name string `toml:"name"`
+
 	Database             string        `toml:"database"`
 	Login                string        `toml:"login"`
 	Password             string        `toml:"password"`
@@ -16,4 +19,50 @@ type Config struct {
 	BlockBufferSize      uint8         `toml:"block_buffer_size"`
 	MaxCompressionBuffer int           `toml:"max_compression_buffer"`
 	MaxExecTime          int           `toml:"max_exec_time"`
+	// AutoMigrate applies migrations from MigrationsDir on start.
+	AutoMigrate bool `toml:"auto_migrate"`
+	// MigrationsDir is a directory with "<version>_<name>.up.sql" and
+	// "<version>_<name>.down.sql" files.
+	MigrationsDir string `toml:"migrations_dir"`
+	// MigrationsTable keeps applied versions. Default: schema_migrations
+	MigrationsTable string `toml:"migrations_table"`
+	// Cluster replaces ${ON_CLUSTER} in migrations with "ON CLUSTER <cluster>"
+	// and makes the migrations table a ReplicatedMergeTree.
+	Cluster string `toml:"cluster"`
+	// Migrations overrides MigrationsDir, e.g. with an embed.FS.
+	Migrations fs.FS `toml:"-"`
+}
+
+type BatchConfig struct {
+	// BatchSize is how many rows of a table are sent in one insert.
+	// Default: 10000
+	BatchSize int `toml:"batch_size"`
+	// MaxBuffered is how many rows of a table may wait for a flush before
+	// Write blocks. Default: 2 * BatchSize
+	MaxBuffered int `toml:"max_buffered"`
+	// FlushInterval flushes incomplete batches. Default: 1s
+	FlushInterval time.Duration `toml:"flush_interval"`
+	// FlushTimeout limits a single insert. Default: 30s
+	FlushTimeout time.Duration `toml:"flush_timeout"`
+	// FlushRetries is how many times a failed insert is retried, rows that
+	// fail to append are not retried. A negative value disables retries.
+	// Default: 3
+	FlushRetries int `toml:"flush_retries"`
+	// OnError receives rows that could not be inserted after all retries.
+	// Without it they are dropped and counted in BatchStats.Dropped.
+	OnError func(table string, rows []any, err error) `toml:"-"`
+}
+
+// Configs is decoded from named tables such as [clickhouse.events].
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
 }
@@ -0,0 +1,504 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMigrationsTable = "schema_migrations"
+	upSuffix               = ".up.sql"
+	downSuffix             = ".down.sql"
+	// onClusterPlaceholder is replaced with "ON CLUSTER <cluster>" or removed
+	// when no cluster is configured.
+	onClusterPlaceholder = "${ON_CLUSTER}"
+	// migrationLockTTL expires the claim of a migrator that stopped
+	// refreshing it, e.g. because it died holding the lock.
+	migrationLockTTL       = time.Minute
+	migrationLockInterval  = time.Second
+	migrationUnlockTimeout = 5 * time.Second
+)
+
+// Migration is a pair of up/down scripts named "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql". Scripts may contain several statements
+// separated by ";" and use ${ON_CLUSTER} in DDL.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationDetails struct {
+	Version int64  `json:"version"`
+	Applied int    `json:"applied"`
+	Pending int    `json:"pending"`
+	Cluster string `json:"cluster,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Migrator applies migrations and tracks them in a (Replicated)MergeTree table.
+// Up and Down of concurrent migrators are serialized by "<table>_lock".
+type Migrator struct {
+	conn       clickhouse.Conn
+	table      string
+	cluster    string
+	migrations []Migration
+
+	mt   sync.Mutex
+	last MigrationDetails
+}
+
+func NewMigrator(conn clickhouse.Conn, table, cluster string, source fs.FS) (*Migrator, error) {
+	if table == "" {
+		table = defaultMigrationsTable
+	}
+	migrations, err := LoadMigrations(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		conn:       conn,
+		table:      table,
+		cluster:    cluster,
+		migrations: migrations,
+	}, nil
+}
+
+// LoadMigrations reads migrations from the root of source.
+func LoadMigrations(source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileName := entry.Name()
+		var (
+			up   bool
+			base string
+		)
+		switch {
+		case strings.HasSuffix(fileName, upSuffix):
+			up, base = true, strings.TrimSuffix(fileName, upSuffix)
+		case strings.HasSuffix(fileName, downSuffix):
+			base = strings.TrimSuffix(fileName, downSuffix)
+		default:
+			continue
+		}
+		versionPart, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", fileName, err)
+		}
+		data, err := fs.ReadFile(source, fileName)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, migration.Name, name)
+		}
+		if up {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	Version  int64  `ch:"version"`
+	Checksum string `ch:"checksum"`
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if a, ok := applied[migration.Version]; ok {
+				if a.Checksum != migration.Checksum {
+					return fmt.Errorf("migration %d_%s checksum mismatch", migration.Version, migration.Name)
+				}
+				continue
+			}
+			if err := m.exec(ctx, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if err := m.record(ctx, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+			if err := m.exec(ctx, migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if err := m.record(ctx, migration, false); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// withLock runs f while holding the migration lock, so replicas started
+// together do not apply the same migration twice. The claim is refreshed
+// while f runs, ctx of f is cancelled if that fails.
+func (m *Migrator) withLock(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		m.refresh(ctx, err)
+	}()
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+	owner, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.keepLock(lockCtx, cancel, owner)
+	}()
+	defer func() {
+		cancel(nil)
+		<-done
+		m.unlock(ctx, owner)
+	}()
+	err = f(lockCtx)
+	if lost := context.Cause(lockCtx); err != nil && lost != nil && ctx.Err() == nil {
+		return errors.Join(err, lost)
+	}
+	return err
+}
+
+// lock inserts a claim and then reads the claims back: the earliest claim
+// that is neither released nor expired holds the lock. A losing claim is
+// released and retried until ctx is done.
+func (m *Migrator) lock(ctx context.Context) (string, error) {
+	for {
+		owner, err := newLockOwner()
+		if err != nil {
+			return "", err
+		}
+		if err := m.claim(ctx, owner, false); err != nil {
+			return "", err
+		}
+		holder, err := m.lockHolder(ctx)
+		if err != nil {
+			m.unlock(ctx, owner)
+			return "", err
+		}
+		if holder == owner {
+			return owner, nil
+		}
+		m.unlock(ctx, owner)
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("migration lock is held by %s: %w", holder, ctx.Err())
+		case <-time.After(migrationLockInterval):
+		}
+	}
+}
+
+// keepLock inserts a fresh claim row every third of migrationLockTTL and
+// cancels ctx when the claim could not be refreshed before it expires.
+func (m *Migrator) keepLock(ctx context.Context, cancel context.CancelCauseFunc, owner string) {
+	ticker := time.NewTicker(migrationLockTTL / 3)
+	defer ticker.Stop()
+	refreshed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := m.claim(ctx, owner, false)
+		if err == nil {
+			refreshed = time.Now()
+			continue
+		}
+		if time.Since(refreshed) >= migrationLockTTL*2/3 {
+			cancel(fmt.Errorf("migration lock refresh: %w", err))
+			return
+		}
+	}
+}
+
+// lockHolder orders owners by their first claim, the latest claim row keeps
+// an owner from expiring.
+func (m *Migrator) lockHolder(ctx context.Context) (string, error) {
+	query := fmt.Sprintf(`SELECT owner
+FROM %s
+GROUP BY owner
+HAVING max(released) = 0 AND max(locked_at) > now64(3) - INTERVAL %d SECOND
+ORDER BY min(locked_at), owner
+LIMIT 1`, m.lockTable(), int(migrationLockTTL.Seconds()))
+	if m.cluster != "" {
+		query += " SETTINGS select_sequential_consistency = 1"
+	}
+	var holder string
+	if err := m.conn.QueryRow(ctx, query).Scan(&holder); err != nil {
+		return "", err
+	}
+	return holder, nil
+}
+
+func (m *Migrator) claim(ctx context.Context, owner string, released bool) error {
+	var flag uint8
+	if released {
+		flag = 1
+	}
+	return m.conn.Exec(m.quorum(ctx), fmt.Sprintf("INSERT INTO %s (owner, released) VALUES (?, ?)", m.lockTable()), owner, flag)
+}
+
+// unlock releases the claim of owner even when ctx is already cancelled.
+func (m *Migrator) unlock(ctx context.Context, owner string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), migrationUnlockTimeout)
+	defer cancel()
+	return m.claim(ctx, owner, true)
+}
+
+// quorum makes inserts on a cluster wait for the majority of replicas and
+// apply in order, select_sequential_consistency only sees such inserts.
+func (m *Migrator) quorum(ctx context.Context) context.Context {
+	if m.cluster == "" {
+		return ctx
+	}
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"insert_quorum":          "auto",
+		"insert_quorum_parallel": 0,
+	}))
+}
+
+func (m *Migrator) lockTable() string {
+	return m.table + "_lock"
+}
+
+func newLockOwner() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (m *Migrator) details() MigrationDetails {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return m.last
+}
+
+func (m *Migrator) refresh(ctx context.Context, migrateErr error) {
+	details := MigrationDetails{Cluster: m.cluster}
+	defer func() {
+		m.mt.Lock()
+		m.last = details
+		m.mt.Unlock()
+	}()
+	if migrateErr != nil {
+		details.Error = migrateErr.Error()
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		details.Error = err.Error()
+		return
+	}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			details.Pending++
+			continue
+		}
+		details.Applied++
+		details.Version = migration.Version
+	}
+}
+
+func (m *Migrator) onCluster() string {
+	if m.cluster == "" {
+		return ""
+	}
+	return fmt.Sprintf("ON CLUSTER `%s`", m.cluster)
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	engine := "MergeTree"
+	if m.cluster != "" {
+		engine = "ReplicatedMergeTree('/clickhouse/tables/{database}/{table}', '{replica}')"
+	}
+	err := m.conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s (
+	version    Int64,
+	name       String,
+	checksum   String,
+	applied    UInt8,
+	applied_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = %s ORDER BY (version, applied_at)`, m.table, m.onCluster(), engine))
+	if err != nil {
+		return err
+	}
+	return m.conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s (
+	owner     String,
+	released  UInt8,
+	locked_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = %s ORDER BY (locked_at, owner) TTL toDateTime(locked_at) + INTERVAL 1 DAY`, m.lockTable(), m.onCluster(), engine))
+}
+
+// applied returns the last state of every version, rows are never updated:
+// reverting a migration inserts a row with applied = 0.
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	query := fmt.Sprintf(`SELECT version, argMax(checksum, applied_at) AS checksum
+FROM %s
+GROUP BY version
+HAVING argMax(applied, applied_at) = 1`, m.table)
+	if m.cluster != "" {
+		query += " SETTINGS select_sequential_consistency = 1"
+	}
+	if err := m.conn.Select(ctx, &rows, query); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) record(ctx context.Context, migration Migration, applied bool) error {
+	var flag uint8
+	if applied {
+		flag = 1
+	}
+	// applied_at is left to the server clock like locked_at
+	return m.conn.Exec(m.quorum(ctx), fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied) VALUES (?, ?, ?, ?)", m.table),
+		migration.Version, migration.Name, migration.Checksum, flag)
+}
+
+func (m *Migrator) exec(ctx context.Context, script string) error {
+	script = strings.ReplaceAll(script, onClusterPlaceholder, m.onCluster())
+	for _, statement := range splitStatements(script) {
+		if err := m.conn.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits script on ";" outside of quotes and comments.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		quote      rune
+	)
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			current.WriteRune(r)
+			if r == '\\' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			current.WriteRune(r)
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			current.WriteRune(' ')
+		case r == ';':
+			statements = appendStatement(statements, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return appendStatement(statements, current.String())
+}
+
+func appendStatement(statements []string, statement string) []string {
+	statement = strings.TrimSpace(statement)
+	if statement == "" {
+		return statements
+	}
+	return append(statements, statement)
+}
+
+func (c *Config) migrationSource() (fs.FS, error) {
+	if c.Migrations != nil {
+		return c.Migrations, nil
+	}
+	if c.MigrationsDir != "" {
+		return os.DirFS(c.MigrationsDir), nil
+	}
+	return nil, errors.New("auto_migrate requires migrations_dir or migrations")
+}
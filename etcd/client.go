@@ -19,15 +19,20 @@ type Client struct {
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.config.Name == "" {
+		return key
+	}
+	return key + "." + c.config.Name
 }
 
 type Details struct {
+	Name  string   `json:"name,omitempty"`
 	Hosts []string `json:"hosts"`
 }
 
 func (c *Client) Details() any {
 	details := new(Details)
+	details.Name = c.config.Name
 	details.Hosts = c.config.Hosts
 	return details
 }
@@ -3,6 +3,7 @@ package etcd
 import "time"
 
 type Config struct {
+	Name string `toml:"name"`
 
 	// AutoSyncInterval is the interval to update endpoints with its latest members.
 	// 0 disables auto-sync. By default auto-sync is disabled.
@@ -52,3 +53,70 @@ type Config struct {
 	// BackoffJitterFraction is the jitter fraction to randomize backoff wait time.
 	BackoffJitterFraction float64 `toml:"backoff_jitter_fraction"`
 }
+
+type ElectionConfig struct {
+	// Name defaults to the name of the etcd client.
+	Name string `toml:"name"`
+
+	// Prefix is the election key prefix shared by all candidates.
+	Prefix string `toml:"prefix"`
+	// Id identifies this candidate. Default: hostname
+	Id string `toml:"id"`
+	// TTL of the leader lease. Leadership is lost when the leader does not
+	// renew the lease for TTL. Default: 10s
+	TTL time.Duration `toml:"ttl"`
+	// RetryInterval is the pause before campaigning again after an error.
+	// Default: 1s
+	RetryInterval time.Duration `toml:"retry_interval"`
+}
+
+type WatcherConfig struct {
+	// Name defaults to the name of the etcd client.
+	Name string `toml:"name"`
+
+	// Prefix is loaded into the typed value. A key "<prefix>/a/b" sets the
+	// field "b" of the field "a", a key equal to the prefix holds a whole
+	// document.
+	Prefix string `toml:"prefix"`
+	// Format of the values: toml, json or yaml. The fields of the typed value
+	// are matched by the tags of the same format. Default: json
+	Format string `toml:"format"`
+	// RetryInterval is the pause before watching again after an error.
+	// Default: 1s
+	RetryInterval time.Duration `toml:"retry_interval"`
+}
+
+type RegistryConfig struct {
+	// Name defaults to the name of the etcd client.
+	Name string `toml:"name"`
+
+	// Prefix of all registered services. Default: /services
+	Prefix string `toml:"prefix"`
+	// Service name the instance is registered under.
+	Service string `toml:"service"`
+	// Id of the instance. Default: hostname
+	Id string `toml:"id"`
+	// Address peers use to reach the instance, e.g. "10.0.0.1:8080".
+	Address string `toml:"address"`
+	// Metadata is published along with Address.
+	Metadata map[string]string `toml:"metadata"`
+	// TTL of the registration lease. Default: 10s
+	TTL time.Duration `toml:"ttl"`
+	// RetryInterval is the pause before registering again after the lease
+	// was lost. Default: 1s
+	RetryInterval time.Duration `toml:"retry_interval"`
+}
+
+// Configs holds one cluster per named table, e.g. [etcd.discovery].
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
+}
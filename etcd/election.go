@@ -0,0 +1,262 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/ihatiko/go-chef-core-sdk/types"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	electionKey          = "etcd-election"
+	defaultElectionTTL   = 10 * time.Second
+	defaultRetryInterval = time.Second
+)
+
+type IElection interface {
+	IsLeader() bool
+	Leader() string
+	// Leadership receives true when this candidate becomes the leader and
+	// false when it loses leadership.
+	Leadership() <-chan bool
+	OnElected(f func(ctx context.Context))
+	OnLost(f func())
+}
+
+// Election campaigns for leadership under ElectionConfig.Prefix until Shutdown.
+type Election struct {
+	types.Component
+	config ElectionConfig
+	client *Client
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mt        sync.Mutex
+	election  *concurrency.Election
+	leaderCtx context.CancelFunc
+	onElected []func(ctx context.Context)
+	onLost    []func()
+
+	leader     atomic.Value
+	isLeader   atomic.Bool
+	leadership chan bool
+}
+
+func (e *Election) GetKey() string {
+	if e.config.Name == "" {
+		return electionKey
+	}
+	return electionKey + "." + e.config.Name
+}
+
+type ElectionDetails struct {
+	Prefix   string `json:"prefix"`
+	Id       string `json:"id"`
+	IsLeader bool   `json:"is_leader"`
+	Leader   string `json:"leader"`
+}
+
+func (e *Election) Details() any {
+	details := ElectionDetails{}
+	details.Prefix = e.config.Prefix
+	details.Id = e.config.Id
+	details.IsLeader = e.IsLeader()
+	details.Leader = e.Leader()
+	return details
+}
+
+func (e *Election) Live(ctx context.Context) error {
+	return e.client.Live(ctx)
+}
+
+func (e *Election) Shutdown() error {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.wg.Wait()
+	return nil
+}
+
+func (e *Election) Connection() IElection {
+	defer store.PackageStore.Load(e)
+	e.AwaitPing()
+	return e
+}
+
+func (e *Election) IsLeader() bool {
+	return e.isLeader.Load()
+}
+
+func (e *Election) Leader() string {
+	leader, _ := e.leader.Load().(string)
+	return leader
+}
+
+func (e *Election) Leadership() <-chan bool {
+	return e.leadership
+}
+
+// OnElected registers f to run when this candidate becomes the leader. ctx is
+// cancelled as soon as leadership is lost.
+func (e *Election) OnElected(f func(ctx context.Context)) {
+	e.mt.Lock()
+	defer e.mt.Unlock()
+	e.onElected = append(e.onElected, f)
+}
+
+func (e *Election) OnLost(f func()) {
+	e.mt.Lock()
+	defer e.mt.Unlock()
+	e.onLost = append(e.onLost, f)
+}
+
+func (c *ElectionConfig) New(client *Client) *Election {
+	election := new(Election)
+	if c.TTL < time.Second {
+		c.TTL = defaultElectionTTL
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = defaultRetryInterval
+	}
+	if c.Id == "" {
+		c.Id, _ = os.Hostname()
+	}
+	if c.Name == "" {
+		c.Name = client.config.Name
+	}
+	election.config = *c
+	election.client = client
+	election.leadership = make(chan bool, 1)
+	election.leader.Store("")
+	if c.Prefix == "" {
+		election.Init.Error = errors.New("no election prefix provided")
+		store.PackageStore.Load(election)
+		return election
+	}
+	if client.Db == nil {
+		election.Init.Error = client.Init.Error
+		store.PackageStore.Load(election)
+		return election
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	election.cancel = cancel
+	election.wg.Add(1)
+	go election.run(ctx)
+	election.Ping(defaultTimeout, election.Live)
+	return election
+}
+
+func (e *Election) run(ctx context.Context) {
+	defer e.wg.Done()
+	for {
+		err := e.campaign(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.config.RetryInterval):
+			}
+		}
+	}
+}
+
+// campaign holds one session: it waits for leadership, keeps it until the
+// session expires and resigns when ctx is cancelled. The session outlives ctx
+// so that resigning and revoking the lease still reach etcd on Shutdown.
+func (e *Election) campaign(ctx context.Context) error {
+	session, err := concurrency.NewSession(e.client.Db,
+		concurrency.WithTTL(int(e.config.TTL.Seconds())),
+		concurrency.WithContext(context.WithoutCancel(ctx)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		session.Orphan()
+		revokeCtx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		defer cancel()
+		_, _ = e.client.Db.Revoke(revokeCtx, session.Lease())
+	}()
+	election := concurrency.NewElection(session, e.config.Prefix)
+
+	observeCtx, stopObserve := context.WithCancel(ctx)
+	defer stopObserve()
+	e.wg.Add(1)
+	go e.observe(observeCtx, election)
+
+	if err := election.Campaign(ctx, e.config.Id); err != nil {
+		return err
+	}
+	e.elected()
+	select {
+	case <-ctx.Done():
+	case <-session.Done():
+	}
+	// both are ready once ctx is cancelled, Shutdown must still resign
+	if ctx.Err() != nil {
+		resignCtx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		defer cancel()
+		err = election.Resign(resignCtx)
+	} else {
+		err = errors.New("etcd election session expired")
+	}
+	e.lost()
+	return err
+}
+
+func (e *Election) observe(ctx context.Context, election *concurrency.Election) {
+	defer e.wg.Done()
+	for response := range election.Observe(ctx) {
+		if len(response.Kvs) > 0 {
+			e.leader.Store(string(response.Kvs[0].Value))
+		}
+	}
+}
+
+// elected and lost run callbacks after releasing mt, so callbacks may
+// register other callbacks.
+func (e *Election) elected() {
+	e.mt.Lock()
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	e.leaderCtx = cancel
+	e.isLeader.Store(true)
+	e.leader.Store(e.config.Id)
+	e.notify(true)
+	callbacks := e.onElected
+	e.mt.Unlock()
+	for _, f := range callbacks {
+		go f(leaderCtx)
+	}
+}
+
+func (e *Election) lost() {
+	e.mt.Lock()
+	if e.leaderCtx != nil {
+		e.leaderCtx()
+		e.leaderCtx = nil
+	}
+	e.isLeader.Store(false)
+	e.notify(false)
+	callbacks := e.onLost
+	e.mt.Unlock()
+	for _, f := range callbacks {
+		f()
+	}
+}
+
+// notify keeps only the latest state for slow readers.
+func (e *Election) notify(state bool) {
+	select {
+	case <-e.leadership:
+	default:
+	}
+	e.leadership <- state
+}
@@ -3,8 +3,12 @@ module github.com/ihatiko/go-chef-clients-providers/etcd
 go 1.23.4
 
 require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/ihatiko/go-chef-clients-providers/lock v0.0.1
 	github.com/ihatiko/go-chef-core-sdk v0.0.1
 	go.etcd.io/etcd/client/v3 v3.5.18
+	google.golang.org/grpc v1.62.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -22,6 +26,7 @@ require (
 	golang.org/x/text v0.22.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240318140521-94a12d6c2237 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
-	google.golang.org/grpc v1.62.1 // indirect
 	google.golang.org/protobuf v1.36.3 // indirect
 )
+
+replace github.com/ihatiko/go-chef-clients-providers/lock v0.0.1 => ../lock
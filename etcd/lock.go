@@ -0,0 +1,87 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"github.com/ihatiko/go-chef-clients-providers/lock"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"time"
+)
+
+const lockPrefix = "/locks/"
+
+// Locker returns a lock.Locker built on etcd concurrency sessions. Every lock
+// owns a lease with the requested ttl that is kept alive until Release, so
+// Refresh only verifies that the session is still alive.
+func (c *Client) Locker() lock.Locker {
+	return &etcdLocker{client: c}
+}
+
+type etcdLocker struct {
+	client *Client
+}
+
+type etcdLock struct {
+	key     string
+	token   int64
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+}
+
+func (l *etcdLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (lock.Lock, error) {
+	seconds := int(ttl.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	session, err := concurrency.NewSession(l.client.Db, concurrency.WithTTL(seconds), concurrency.WithContext(context.WithoutCancel(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	mutex := concurrency.NewMutex(session, lockPrefix+key)
+	if err := mutex.TryLock(ctx); err != nil {
+		_ = session.Close()
+		if errors.Is(err, concurrency.ErrLocked) {
+			return nil, lock.ErrNotAcquired
+		}
+		return nil, err
+	}
+	// the txn revision of TryLock is not the create revision when the key
+	// already existed, so it is read back
+	response, err := l.client.Db.Get(ctx, mutex.Key())
+	if err == nil && len(response.Kvs) == 0 {
+		err = lock.ErrLockLost
+	}
+	if err != nil {
+		_ = mutex.Unlock(context.WithoutCancel(ctx))
+		_ = session.Close()
+		return nil, err
+	}
+	return &etcdLock{key: key, token: response.Kvs[0].CreateRevision, session: session, mutex: mutex}, nil
+}
+
+func (l *etcdLock) Key() string {
+	return l.key
+}
+
+// Token is the create revision of the lock key, it grows with every acquisition.
+func (l *etcdLock) Token() int64 {
+	return l.token
+}
+
+func (l *etcdLock) Refresh(ctx context.Context, _ time.Duration) error {
+	select {
+	case <-l.session.Done():
+		return lock.ErrLockLost
+	default:
+	}
+	_, err := l.session.Client().KeepAliveOnce(ctx, l.session.Lease())
+	if err != nil {
+		return errors.Join(lock.ErrLockLost, err)
+	}
+	return nil
+}
+
+func (l *etcdLock) Release(ctx context.Context) error {
+	err := l.mutex.Unlock(ctx)
+	return errors.Join(err, l.session.Close())
+}
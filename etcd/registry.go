@@ -0,0 +1,197 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/ihatiko/go-chef-core-sdk/types"
+	etcd "go.etcd.io/etcd/client/v3"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	registryKey           = "etcd-registry"
+	defaultRegistryPrefix = "/services"
+	defaultRegistryTTL    = 10 * time.Second
+)
+
+// Endpoint is a registered service instance.
+type Endpoint struct {
+	Id       string            `json:"id"`
+	Address  string            `json:"address"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Registry keeps the instance registered under a lease until Shutdown.
+type Registry struct {
+	types.Component
+	config RegistryConfig
+	client *Client
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	lease      atomic.Int64
+	registered atomic.Bool
+	lastError  atomic.Value
+}
+
+func (r *Registry) GetKey() string {
+	if r.config.Name == "" {
+		return registryKey
+	}
+	return registryKey + "." + r.config.Name
+}
+
+type RegistryDetails struct {
+	Key        string `json:"key"`
+	Address    string `json:"address"`
+	Registered bool   `json:"registered"`
+	Lease      int64  `json:"lease"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+func (r *Registry) Details() any {
+	details := RegistryDetails{}
+	details.Key = r.key()
+	details.Address = r.config.Address
+	details.Registered = r.registered.Load()
+	details.Lease = r.lease.Load()
+	if lastError, ok := r.lastError.Load().(string); ok {
+		details.LastError = lastError
+	}
+	return details
+}
+
+func (r *Registry) Live(ctx context.Context) error {
+	if !r.registered.Load() {
+		if lastError, ok := r.lastError.Load().(string); ok {
+			return errors.New(lastError)
+		}
+		return errors.New("etcd registry is not registered")
+	}
+	return r.client.Live(ctx)
+}
+
+// Shutdown stops keepalive and revokes the lease, so peers see the instance
+// gone immediately instead of after TTL.
+func (r *Registry) Shutdown() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+	lease := r.lease.Load()
+	if lease == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	_, err := r.client.Db.Revoke(ctx, etcd.LeaseID(lease))
+	r.registered.Store(false)
+	return err
+}
+
+func (r *Registry) Connection() *Registry {
+	defer store.PackageStore.Load(r)
+	r.AwaitPing()
+	return r
+}
+
+func (r *Registry) key() string {
+	return path.Join(r.config.Prefix, r.config.Service, r.config.Id)
+}
+
+func (c *RegistryConfig) New(client *Client) *Registry {
+	registry := new(Registry)
+	if c.Prefix == "" {
+		c.Prefix = defaultRegistryPrefix
+	}
+	if c.Id == "" {
+		c.Id, _ = os.Hostname()
+	}
+	if c.TTL < time.Second {
+		c.TTL = defaultRegistryTTL
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = defaultRetryInterval
+	}
+	if c.Name == "" {
+		c.Name = client.config.Name
+	}
+	registry.config = *c
+	registry.client = client
+	switch {
+	case c.Service == "":
+		registry.Init.Error = errors.New("no registry service provided")
+	case c.Address == "":
+		registry.Init.Error = errors.New("no registry address provided")
+	case client.Db == nil:
+		registry.Init.Error = client.Init.Error
+	}
+	if registry.Init.Error != nil {
+		store.PackageStore.Load(registry)
+		return registry
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	registry.cancel = cancel
+	registry.wg.Add(1)
+	go registry.run(ctx)
+	registry.Ping(defaultTimeout, registry.Live)
+	return registry
+}
+
+func (r *Registry) run(ctx context.Context) {
+	defer r.wg.Done()
+	for {
+		err := r.register(ctx)
+		r.registered.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.lastError.Store(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.config.RetryInterval):
+		}
+	}
+}
+
+// register puts the endpoint with a fresh lease and blocks while the lease is
+// kept alive.
+func (r *Registry) register(ctx context.Context) error {
+	value, err := json.Marshal(Endpoint{
+		Id:       r.config.Id,
+		Address:  r.config.Address,
+		Metadata: r.config.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	lease, err := r.client.Db.Grant(ctx, int64(r.config.TTL.Seconds()))
+	if err != nil {
+		return err
+	}
+	r.lease.Store(int64(lease.ID))
+	if _, err := r.client.Db.Put(ctx, r.key(), string(value), etcd.WithLease(lease.ID)); err != nil {
+		return err
+	}
+	keepAlive, err := r.client.Db.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return err
+	}
+	r.registered.Store(true)
+	for range keepAlive {
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("etcd registry lease keepalive stopped")
+}
@@ -0,0 +1,184 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	etcd "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/resolver"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resolver looks up endpoints registered by Registry.
+type Resolver struct {
+	client *Client
+	prefix string
+}
+
+// Resolver returns a resolver of services registered under prefix.
+// Default prefix: /services
+func (c *Client) Resolver(prefix string) *Resolver {
+	if prefix == "" {
+		prefix = defaultRegistryPrefix
+	}
+	return &Resolver{client: c, prefix: prefix}
+}
+
+func (r *Resolver) servicePrefix(service string) string {
+	return path.Join(r.prefix, service) + "/"
+}
+
+// Resolve returns live endpoints of service.
+func (r *Resolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	endpoints, _, err := r.load(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	return sortedEndpoints(endpoints), nil
+}
+
+func (r *Resolver) load(ctx context.Context, service string) (map[string]Endpoint, int64, error) {
+	response, err := r.client.Db.Get(ctx, r.servicePrefix(service), etcd.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	endpoints := make(map[string]Endpoint, len(response.Kvs))
+	for _, kv := range response.Kvs {
+		endpoint := Endpoint{}
+		if err := json.Unmarshal(kv.Value, &endpoint); err != nil {
+			continue
+		}
+		endpoints[string(kv.Key)] = endpoint
+	}
+	return endpoints, response.Header.Revision, nil
+}
+
+// Watch sends the full list of endpoints on every change until ctx is done.
+// The first list is sent right away.
+func (r *Resolver) Watch(ctx context.Context, service string) <-chan []Endpoint {
+	return r.watchErrors(ctx, service, nil)
+}
+
+// watchErrors is Watch that passes load and watch errors to onError, the
+// watch is restarted after them.
+func (r *Resolver) watchErrors(ctx context.Context, service string, onError func(err error)) <-chan []Endpoint {
+	updates := make(chan []Endpoint, 1)
+	go func() {
+		defer close(updates)
+		for ctx.Err() == nil {
+			if err := r.watch(ctx, service, updates); err != nil && ctx.Err() == nil && onError != nil {
+				onError(err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(defaultRetryInterval):
+			}
+		}
+	}()
+	return updates
+}
+
+func (r *Resolver) watch(ctx context.Context, service string, updates chan<- []Endpoint) error {
+	endpoints, revision, err := r.load(ctx, service)
+	if err != nil {
+		return err
+	}
+	if !send(ctx, updates, sortedEndpoints(endpoints)) {
+		return nil
+	}
+	watchCtx, cancel := context.WithCancel(etcd.WithRequireLeader(ctx))
+	defer cancel()
+	events := r.client.Db.Watch(watchCtx, r.servicePrefix(service), etcd.WithPrefix(), etcd.WithRev(revision+1))
+	for response := range events {
+		if err := response.Err(); err != nil {
+			return err
+		}
+		for _, event := range response.Events {
+			switch event.Type {
+			case etcd.EventTypePut:
+				endpoint := Endpoint{}
+				if err := json.Unmarshal(event.Kv.Value, &endpoint); err == nil {
+					endpoints[string(event.Kv.Key)] = endpoint
+				}
+			case etcd.EventTypeDelete:
+				delete(endpoints, string(event.Kv.Key))
+			}
+		}
+		if !send(ctx, updates, sortedEndpoints(endpoints)) {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+func send(ctx context.Context, updates chan<- []Endpoint, endpoints []Endpoint) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case updates <- endpoints:
+		return true
+	}
+}
+
+func sortedEndpoints(endpoints map[string]Endpoint) []Endpoint {
+	result := make([]Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		result = append(result, endpoint)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+const grpcScheme = "etcd"
+
+// GRPCBuilder returns a gRPC resolver builder for targets like
+// "etcd:///<service>", use it with grpc.WithResolvers.
+func (r *Resolver) GRPCBuilder() resolver.Builder {
+	return &grpcBuilder{resolver: r}
+}
+
+type grpcBuilder struct {
+	resolver *Resolver
+}
+
+func (b *grpcBuilder) Scheme() string {
+	return grpcScheme
+}
+
+func (b *grpcBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &grpcResolver{cancel: cancel}
+	service := target.Endpoint()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for endpoints := range b.resolver.watchErrors(ctx, service, cc.ReportError) {
+			// ServerName stays empty, TLS verifies the channel authority,
+			// e.g. the one set with grpc.WithAuthority
+			addresses := make([]resolver.Address, len(endpoints))
+			for i, endpoint := range endpoints {
+				addresses[i] = resolver.Address{Addr: endpoint.Address}
+			}
+			if err := cc.UpdateState(resolver.State{Addresses: addresses}); err != nil {
+				cc.ReportError(err)
+			}
+		}
+	}()
+	return r, nil
+}
+
+type grpcResolver struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (r *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *grpcResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
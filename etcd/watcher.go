@@ -0,0 +1,365 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/ihatiko/go-chef-core-sdk/types"
+	etcd "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	watcherKey = "etcd-watcher"
+
+	FormatJSON = "json"
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+)
+
+// Watcher keeps a typed value in sync with a key prefix. Updates from a single
+// watch response are applied together and only if every validator accepts the
+// resulting value.
+type Watcher[T any] struct {
+	types.Component
+	config WatcherConfig
+	client *Client
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mt         sync.Mutex
+	kvs        map[string][]byte
+	validators []func(value *T) error
+	onChange   []func(old, new *T)
+
+	value     atomic.Pointer[T]
+	revision  atomic.Int64
+	rejected  atomic.Int64
+	lastError atomic.Value
+}
+
+func (w *Watcher[T]) GetKey() string {
+	if w.config.Name == "" {
+		return watcherKey
+	}
+	return watcherKey + "." + w.config.Name
+}
+
+type WatcherDetails struct {
+	Prefix    string `json:"prefix"`
+	Revision  int64  `json:"revision"`
+	Rejected  int64  `json:"rejected"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func (w *Watcher[T]) Details() any {
+	details := WatcherDetails{}
+	details.Prefix = w.config.Prefix
+	details.Revision = w.revision.Load()
+	details.Rejected = w.rejected.Load()
+	if lastError, ok := w.lastError.Load().(string); ok {
+		details.LastError = lastError
+	}
+	return details
+}
+
+func (w *Watcher[T]) Live(ctx context.Context) error {
+	if w.value.Load() == nil {
+		if lastError, ok := w.lastError.Load().(string); ok {
+			return errors.New(lastError)
+		}
+		return errors.New("etcd watcher is not loaded")
+	}
+	return w.client.Live(ctx)
+}
+
+func (w *Watcher[T]) Shutdown() error {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Watcher[T]) Connection() *Watcher[T] {
+	defer store.PackageStore.Load(w)
+	w.AwaitPing()
+	return w
+}
+
+// Get returns the current value, it must not be modified.
+func (w *Watcher[T]) Get() *T {
+	return w.value.Load()
+}
+
+func (w *Watcher[T]) Revision() int64 {
+	return w.revision.Load()
+}
+
+// OnChange registers f to run after a new value is applied.
+func (w *Watcher[T]) OnChange(f func(old, new *T)) {
+	w.mt.Lock()
+	defer w.mt.Unlock()
+	w.onChange = append(w.onChange, f)
+}
+
+// NewWatcher loads cfg.Prefix and watches it until Shutdown. Validators reject
+// values (including the initial one) by returning an error.
+func NewWatcher[T any](cfg WatcherConfig, client *Client, validators ...func(value *T) error) *Watcher[T] {
+	watcher := new(Watcher[T])
+	if cfg.Format == "" {
+		cfg.Format = FormatJSON
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.Name == "" {
+		cfg.Name = client.config.Name
+	}
+	watcher.config = cfg
+	watcher.client = client
+	watcher.validators = validators
+	watcher.kvs = map[string][]byte{}
+	switch {
+	case cfg.Prefix == "":
+		watcher.Init.Error = errors.New("no watcher prefix provided")
+	case cfg.Format != FormatJSON && cfg.Format != FormatTOML && cfg.Format != FormatYAML:
+		watcher.Init.Error = fmt.Errorf("unknown watcher format: %s", cfg.Format)
+	case client.Db == nil:
+		watcher.Init.Error = client.Init.Error
+	}
+	if watcher.Init.Error != nil {
+		store.PackageStore.Load(watcher)
+		return watcher
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher.cancel = cancel
+	watcher.wg.Add(1)
+	go watcher.run(ctx)
+	watcher.Ping(defaultTimeout, watcher.Live)
+	return watcher
+}
+
+func (w *Watcher[T]) run(ctx context.Context) {
+	defer w.wg.Done()
+	for {
+		err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.lastError.Store(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.config.RetryInterval):
+		}
+	}
+}
+
+// watch resumes from the last seen revision, a full reload is done on start
+// and when that revision was compacted.
+func (w *Watcher[T]) watch(ctx context.Context) error {
+	if w.revision.Load() == 0 {
+		if err := w.load(ctx); err != nil {
+			return err
+		}
+	}
+	watchCtx, cancel := context.WithCancel(etcd.WithRequireLeader(ctx))
+	defer cancel()
+	events := w.client.Db.Watch(watchCtx, w.config.Prefix, etcd.WithPrefix(), etcd.WithRev(w.revision.Load()+1))
+	for response := range events {
+		if err := response.Err(); err != nil {
+			if response.CompactRevision > 0 {
+				w.revision.Store(0)
+			}
+			return err
+		}
+		kvs := w.snapshot()
+		changed := false
+		for _, event := range response.Events {
+			if !w.owns(string(event.Kv.Key)) {
+				continue
+			}
+			changed = true
+			switch event.Type {
+			case etcd.EventTypePut:
+				kvs[string(event.Kv.Key)] = event.Kv.Value
+			case etcd.EventTypeDelete:
+				delete(kvs, string(event.Kv.Key))
+			}
+		}
+		// a rejected batch is still kept in kvs, so the keys mirror etcd and
+		// the next valid update is decoded from all of them
+		if changed {
+			if err := w.apply(kvs); err != nil {
+				w.rejected.Add(1)
+				w.lastError.Store(err.Error())
+			}
+		}
+		w.revision.Store(response.Header.Revision)
+	}
+	return ctx.Err()
+}
+
+func (w *Watcher[T]) load(ctx context.Context) error {
+	response, err := w.client.Db.Get(ctx, w.config.Prefix, etcd.WithPrefix())
+	if err != nil {
+		return err
+	}
+	kvs := make(map[string][]byte, len(response.Kvs))
+	for _, kv := range response.Kvs {
+		if w.owns(string(kv.Key)) {
+			kvs[string(kv.Key)] = kv.Value
+		}
+	}
+	if err := w.apply(kvs); err != nil {
+		return err
+	}
+	w.revision.Store(response.Header.Revision)
+	return nil
+}
+
+func (w *Watcher[T]) snapshot() map[string][]byte {
+	w.mt.Lock()
+	defer w.mt.Unlock()
+	return maps.Clone(w.kvs)
+}
+
+// owns reports whether key is the prefix itself or below it, sibling keys
+// sharing the prefix, e.g. "/app/config2" for "/app/config", are skipped.
+func (w *Watcher[T]) owns(key string) bool {
+	prefix := strings.TrimSuffix(w.config.Prefix, "/")
+	return key == prefix || strings.HasPrefix(key, prefix+"/")
+}
+
+// apply stores kvs and swaps the value when it decodes and every validator
+// accepts it. OnChange callbacks run after mt is released.
+func (w *Watcher[T]) apply(kvs map[string][]byte) error {
+	w.mt.Lock()
+	w.kvs = kvs
+	value, err := w.decode(kvs)
+	if err == nil {
+		for _, validate := range w.validators {
+			if err = validate(value); err != nil {
+				err = fmt.Errorf("etcd watcher rejected update: %w", err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		w.mt.Unlock()
+		return err
+	}
+	old := w.value.Swap(value)
+	callbacks := w.onChange
+	w.mt.Unlock()
+	for _, f := range callbacks {
+		f(old, value)
+	}
+	return nil
+}
+
+// decode merges all keys into one document and decodes it into T.
+func (w *Watcher[T]) decode(kvs map[string][]byte) (*T, error) {
+	document := map[string]any{}
+	prefix := strings.TrimSuffix(w.config.Prefix, "/")
+	for key, raw := range kvs {
+		value := w.decodeValue(raw)
+		path := strings.Trim(strings.TrimPrefix(key, prefix), "/")
+		if path == "" {
+			if fields, ok := value.(map[string]any); ok {
+				mergeDocument(document, fields)
+			}
+			continue
+		}
+		parts := strings.Split(path, "/")
+		node := document
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[part] = child
+			}
+			node = child
+		}
+		last := parts[len(parts)-1]
+		if fields, ok := value.(map[string]any); ok {
+			if existing, ok := node[last].(map[string]any); ok {
+				mergeDocument(existing, fields)
+				continue
+			}
+		}
+		node[last] = value
+	}
+	data, err := w.marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	value := new(T)
+	if err := w.unmarshal(data, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// decodeValue decodes a document of the configured format, then a json
+// scalar, and falls back to the raw string.
+func (w *Watcher[T]) decodeValue(raw []byte) any {
+	document := map[string]any{}
+	if err := w.unmarshal(raw, &document); err == nil && len(document) > 0 {
+		return document
+	}
+	var scalar any
+	if err := json.Unmarshal(raw, &scalar); err == nil {
+		return scalar
+	}
+	return string(raw)
+}
+
+func (w *Watcher[T]) marshal(document map[string]any) ([]byte, error) {
+	switch w.config.Format {
+	case FormatTOML:
+		buffer := new(bytes.Buffer)
+		err := toml.NewEncoder(buffer).Encode(document)
+		return buffer.Bytes(), err
+	case FormatYAML:
+		return yaml.Marshal(document)
+	default:
+		return json.Marshal(document)
+	}
+}
+
+func (w *Watcher[T]) unmarshal(data []byte, value any) error {
+	switch w.config.Format {
+	case FormatTOML:
+		return toml.Unmarshal(data, value)
+	case FormatYAML:
+		return yaml.Unmarshal(data, value)
+	default:
+		return json.Unmarshal(data, value)
+	}
+}
+
+func mergeDocument(dst, src map[string]any) {
+	for key, value := range src {
+		if fields, ok := value.(map[string]any); ok {
+			if existing, ok := dst[key].(map[string]any); ok {
+				mergeDocument(existing, fields)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
@@ -3,7 +3,23 @@ package gitlab
 import "time"
 
 type Config struct {
+	Name string `toml:"name"`
+
 	Host          string        `toml:"host"`
 	Token         string        `toml:"token"`
 	HealthTimeout time.Duration `toml:"health_timeout"`
 }
+
+// Configs maps [gitlab.<name>] tables to instances.
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
+}
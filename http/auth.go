@@ -0,0 +1,140 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"net/http"
+	"os"
+	"resty.dev/v3"
+	"time"
+)
+
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthAPIKey = "api_key"
+	AuthOAuth2 = "oauth2"
+
+	defaultAPIKeyHeader  = "X-API-Key"
+	defaultRefreshBefore = 30 * time.Second
+)
+
+func (c Config) applyAuth(client *resty.Client) error {
+	auth := c.Auth
+	switch auth.Type {
+	case "":
+	case AuthBearer:
+		if auth.Token == "" {
+			return errors.New("bearer auth requires token")
+		}
+		client.SetAuthToken(auth.Token)
+	case AuthBasic:
+		client.SetBasicAuth(auth.Login, auth.Password)
+	case AuthAPIKey:
+		if auth.APIKey == "" {
+			return errors.New("api_key auth requires api_key")
+		}
+		header := auth.APIKeyHeader
+		if header == "" {
+			header = defaultAPIKeyHeader
+		}
+		client.SetHeader(header, auth.APIKey)
+	case AuthOAuth2:
+		tokenSource, err := auth.OAuth2.tokenSource(client.Client())
+		if err != nil {
+			return err
+		}
+		client.AddRequestMiddleware(func(_ *resty.Client, request *resty.Request) error {
+			token, err := tokenSource.Token()
+			if err != nil {
+				return fmt.Errorf("oauth2 token: %w", err)
+			}
+			request.SetAuthScheme(token.Type())
+			request.SetAuthToken(token.AccessToken)
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown auth type: %s", auth.Type)
+	}
+	return nil
+}
+
+// tokenSource caches the client credentials token and fetches a new one
+// RefreshBefore its expiry.
+func (c OAuth2Config) tokenSource(httpClient *http.Client) (oauth2.TokenSource, error) {
+	if c.TokenURL == "" || c.ClientID == "" {
+		return nil, errors.New("oauth2 auth requires token_url and client_id")
+	}
+	if c.RefreshBefore == 0 {
+		c.RefreshBefore = defaultRefreshBefore
+	}
+	config := clientcredentials.Config{
+		ClientID:       c.ClientID,
+		ClientSecret:   c.ClientSecret,
+		TokenURL:       c.TokenURL,
+		Scopes:         c.Scopes,
+		EndpointParams: map[string][]string{},
+	}
+	for key, value := range c.Params {
+		config.EndpointParams[key] = []string{value}
+	}
+	// The token client shares the TLS settings of the resty client, but not
+	// its timeout-free default.
+	tokenClient := &http.Client{Transport: httpClient.Transport, Timeout: defaultTimeout}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tokenClient)
+	return oauth2.ReuseTokenSourceWithExpiry(nil, config.TokenSource(ctx), c.RefreshBefore), nil
+}
+
+// tlsConfig builds a client TLS configuration with a custom CA and a client
+// certificate for mutual TLS. Certificates are PEM content or file paths.
+func (c TLSConfig) tlsConfig() (*tls.Config, error) {
+	if c.CA == "" && c.CAFile == "" && c.Cert == "" && c.CertFile == "" && !c.InsecureSkipVerify && c.ServerName == "" {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	ca, err := pemOrFile(c.CA, c.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	if ca != nil {
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("tls: no certificates found in ca")
+		}
+		config.RootCAs = caCertPool
+	}
+	cert, err := pemOrFile(c.Cert, c.CertFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := pemOrFile(c.Key, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil || key != nil {
+		certificate, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("tls: client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+func pemOrFile(content, file string) ([]byte, error) {
+	if content != "" {
+		return []byte(content), nil
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
@@ -0,0 +1,172 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+
+	defaultFailureThreshold = 5
+	defaultSuccessThreshold = 1
+	defaultOpenTimeout      = 10 * time.Second
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// breaker is a circuit breaker of a single host.
+type breaker struct {
+	mt        sync.Mutex
+	cfg       CircuitBreakerConfig
+	state     string
+	failures  int
+	successes int
+	openedAt  time.Time
+	// trial is set while the single request admitted in half-open state is
+	// in flight.
+	trial bool
+}
+
+// allow reports whether a request may pass and whether it is the trial of a
+// half-open breaker, the trial has to be passed to record or release.
+func (b *breaker) allow(now time.Time) (bool, bool) {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	if b.state == breakerOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.state = breakerHalfOpen
+		b.successes = 0
+		b.trial = false
+	}
+	switch b.state {
+	case breakerOpen:
+		return false, false
+	case breakerHalfOpen:
+		if b.trial {
+			return false, false
+		}
+		b.trial = true
+		return true, true
+	}
+	return true, false
+}
+
+// release frees the trial without an outcome, e.g. when it was cancelled.
+func (b *breaker) release(trial bool) {
+	if !trial {
+		return
+	}
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	b.trial = false
+}
+
+func (b *breaker) record(failed, trial bool, now time.Time) {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	if trial {
+		b.trial = false
+	} else if b.state == breakerHalfOpen {
+		// admitted before the breaker opened, only the trial decides
+		return
+	}
+	switch {
+	case failed && b.state == breakerHalfOpen:
+		b.open(now)
+	case failed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open(now)
+		}
+	case b.state == breakerHalfOpen:
+		b.successes++
+		if b.successes >= b.cfg.SuccessThreshold {
+			b.state = breakerClosed
+			b.failures = 0
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.openedAt = now
+	b.failures = 0
+	b.successes = 0
+}
+
+func (b *breaker) currentState() string {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	return b.state
+}
+
+// breakerTransport keeps a circuit breaker per host. Transport errors and 5xx
+// responses count as failures, every retry attempt is recorded separately.
+type breakerTransport struct {
+	next     http.RoundTripper
+	cfg      CircuitBreakerConfig
+	mt       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerTransport(next http.RoundTripper, cfg CircuitBreakerConfig) *breakerTransport {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = defaultSuccessThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultOpenTimeout
+	}
+	return &breakerTransport{
+		next:     next,
+		cfg:      cfg,
+		breakers: map[string]*breaker{},
+	}
+}
+
+func (t *breakerTransport) breaker(host string) *breaker {
+	t.mt.Lock()
+	defer t.mt.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &breaker{cfg: t.cfg, state: breakerClosed}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	b := t.breaker(request.URL.Host)
+	allowed, trial := b.allow(time.Now())
+	if !allowed {
+		return nil, fmt.Errorf("%s: %w", request.URL.Host, ErrCircuitOpen)
+	}
+	response, err := t.next.RoundTrip(request)
+	if err != nil && request.Context().Err() != nil {
+		// Cancelled by the caller, the host is not to blame.
+		b.release(trial)
+		return response, err
+	}
+	failed := err != nil || response.StatusCode >= http.StatusInternalServerError
+	b.record(failed, trial, time.Now())
+	return response, err
+}
+
+func (t *breakerTransport) states() map[string]string {
+	t.mt.Lock()
+	defer t.mt.Unlock()
+	states := make(map[string]string, len(t.breakers))
+	for host, b := range t.breakers {
+		states[host] = b.currentState()
+	}
+	return states
+}
@@ -2,11 +2,13 @@ package clickhouse
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
 	"github.com/ihatiko/go-chef-core-sdk/store"
 	"github.com/ihatiko/go-chef-core-sdk/types"
+	"net/http"
 	"resty.dev/v3"
+	"slices"
 	"time"
 )
 
@@ -18,18 +20,24 @@ const (
 
 type Client struct {
 	types.Component
-	config Config
-	client *resty.Client
+	config      Config
+	client      *resty.Client
+	probeClient *resty.Client
+	breakers    *breakerTransport
+	probes      probeStore
 }
 
 func (c *Client) Live(ctx context.Context) error {
+	if c.client == nil {
+		return c.Init.Error
+	}
 	return c.liveness(ctx)
 }
 func (c *Client) Shutdown() error {
 	if c.client == nil {
 		return nil
 	}
-	return c.client.Close()
+	return errors.Join(c.client.Close(), c.probeClient.Close())
 }
 
 func (c *Client) Name() string {
@@ -37,24 +45,40 @@ func (c *Client) Name() string {
 }
 
 type Details struct {
-	Host       string        `json:"host"`
-	HealthHost string        `json:"health_host"`
-	Timeout    time.Duration `json:"timeout"`
+	Name       string            `json:"name,omitempty"`
+	Host       string            `json:"host"`
+	HealthHost string            `json:"health_host"`
+	Timeout    time.Duration     `json:"timeout"`
+	Retries    int               `json:"retries"`
+	Breakers   map[string]string `json:"breakers,omitempty"`
+	LastProbe  *Probe            `json:"last_probe,omitempty"`
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.config.Name == "" {
+		return key
+	}
+	return key + "." + c.config.Name
 }
 
 func (c *Client) Details() any {
 	details := new(Details)
+	details.Name = c.config.Name
 	details.Host = c.config.Host
 	details.HealthHost = c.config.HealthHost
 	details.Timeout = c.config.Timeout
+	details.Retries = c.config.Retry.Count
+	if c.breakers != nil {
+		details.Breakers = c.breakers.states()
+	}
+	details.LastProbe = c.probes.get()
 	return details
 }
 func (c *Client) Connection() *resty.Client {
 	defer store.PackageStore.Load(c)
+	if c.client == nil {
+		return resty.New()
+	}
 	c.AwaitPing()
 	return c.client
 }
@@ -64,26 +88,90 @@ func (c Config) New() *Client {
 	if c.Timeout == 0 {
 		c.Timeout = defaultTimeout
 	}
+	if c.Health.Method == "" {
+		c.Health.Method = http.MethodGet
+	}
+	if c.Health.Timeout == 0 {
+		c.Health.Timeout = c.Timeout
+	}
 	client.config = c
-	restyClient := resty.New().
-		SetBaseURL(c.Host).
-		SetHeaders(c.Headers)
+	tlsConfig, err := c.TLS.tlsConfig()
+	if err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
+	restyClient, err := c.newResty(tlsConfig)
+	if err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
+	// probes skip retries and the circuit breaker, so a failing health
+	// endpoint does not open the breaker of the API host
+	probeClient, err := c.newResty(tlsConfig)
+	if err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
+	c.applyRetry(restyClient)
+	if c.CircuitBreaker.Enabled {
+		client.breakers = newBreakerTransport(restyClient.Transport(), c.CircuitBreaker)
+		restyClient.SetTransport(client.breakers)
+	}
+	if !c.Telemetry.DisableTracing || !c.Telemetry.DisableMetrics {
+		transport, err := newTelemetryTransport(restyClient.Transport(), c.Telemetry)
+		if err != nil {
+			client.Init.Error = err
+			store.PackageStore.Load(client)
+			return client
+		}
+		restyClient.SetTransport(transport).
+			AddRequestMiddleware(routeMiddleware)
+	}
 
 	client.client = restyClient
-	client.Ping(c.Timeout, client.liveness)
+	client.probeClient = probeClient
+	client.Ping(c.Health.Timeout, client.liveness)
 	return client
 }
 
-func (c *Client) liveness(ctx context.Context) error {
-	response, err := c.client.
-		NewRequest().
-		SetContext(ctx).
-		Get(c.config.HealthHost)
-	if err != nil {
-		return err
+// newResty creates a client with the settings shared by requests and probes.
+func (c Config) newResty(tlsConfig *tls.Config) (*resty.Client, error) {
+	restyClient := resty.New().
+		SetBaseURL(c.Host).
+		SetHeaders(c.Headers).
+		SetTimeout(c.Timeout)
+	if tlsConfig != nil {
+		restyClient.SetTLSClientConfig(tlsConfig)
+	}
+	if err := c.applyAuth(restyClient); err != nil {
+		return nil, err
+	}
+	return restyClient, nil
+}
+
+func (c Config) applyRetry(client *resty.Client) {
+	if c.Retry.Count <= 0 {
+		return
+	}
+	client.SetRetryCount(c.Retry.Count).
+		SetAllowNonIdempotentRetry(c.Retry.NonIdempotent)
+	if c.Retry.WaitTime > 0 {
+		client.SetRetryWaitTime(c.Retry.WaitTime)
+	}
+	if c.Retry.MaxWaitTime > 0 {
+		client.SetRetryMaxWaitTime(c.Retry.MaxWaitTime)
 	}
-	if response.StatusCode() > 400 {
-		return errors.New(fmt.Sprintf("error check component status code: %d", response.StatusCode()))
+	if len(c.Retry.StatusCodes) > 0 {
+		statusCodes := c.Retry.StatusCodes
+		client.SetRetryDefaultConditions(false).
+			AddRetryConditions(func(response *resty.Response, err error) bool {
+				if err != nil {
+					return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrCircuitOpen)
+				}
+				return slices.Contains(statusCodes, response.StatusCode())
+			})
 	}
-	return nil
 }
@@ -3,8 +3,121 @@ package clickhouse
 import "time"
 
 type Config struct {
+	Name string `toml:"name"`
+
 	Host       string            `toml:"host"`
 	Headers    map[string]string `toml:"headers"`
 	HealthHost string            `toml:"health_host"`
 	Timeout    time.Duration     `toml:"timeout"`
+
+	Retry          RetryConfig          `toml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `toml:"circuit_breaker"`
+	Auth           AuthConfig           `toml:"auth"`
+	TLS            TLSConfig            `toml:"tls"`
+	Telemetry      TelemetryConfig      `toml:"telemetry"`
+	// RequestIDHeader is reported in ResponseError. Default: X-Request-Id
+	RequestIDHeader string       `toml:"request_id_header"`
+	Health          HealthConfig `toml:"health"`
+}
+
+// HealthConfig configures the probe of HealthHost.
+type HealthConfig struct {
+	// Host is the base URL of HealthHost when it differs from Host.
+	Host string `toml:"host"`
+	// Method of the probe. Default: GET
+	Method string `toml:"method"`
+	// ExpectedStatus lists healthy status codes. Default: 2xx
+	ExpectedStatus []int `toml:"expected_status"`
+	// Assertions compare fields of the JSON body, keys are dot separated
+	// paths, e.g. status = "UP".
+	Assertions map[string]string `toml:"assertions"`
+	// Timeout of the probe. Default: Timeout
+	Timeout time.Duration `toml:"timeout"`
+}
+
+// TelemetryConfig configures OpenTelemetry instrumentation, it uses the global
+// tracer, meter provider and propagator.
+type TelemetryConfig struct {
+	DisableTracing bool `toml:"disable_tracing"`
+	DisableMetrics bool `toml:"disable_metrics"`
+	// Buckets of the request duration histogram in seconds.
+	Buckets []float64 `toml:"buckets"`
+}
+
+type AuthConfig struct {
+	// Type is one of: bearer, basic, api_key, oauth2. Empty disables auth.
+	Type     string `toml:"type"`
+	Token    string `toml:"token"`
+	Login    string `toml:"login"`
+	Password string `toml:"password"`
+	// APIKeyHeader carries APIKey. Default: X-API-Key
+	APIKeyHeader string       `toml:"api_key_header"`
+	APIKey       string       `toml:"api_key"`
+	OAuth2       OAuth2Config `toml:"oauth2"`
+}
+
+// OAuth2Config configures the client credentials flow.
+type OAuth2Config struct {
+	TokenURL     string   `toml:"token_url"`
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	Scopes       []string `toml:"scopes"`
+	// Params are extra token request parameters, e.g. audience.
+	Params map[string]string `toml:"params"`
+	// RefreshBefore fetches a new token this long before expiry. Default: 30s
+	RefreshBefore time.Duration `toml:"refresh_before"`
+}
+
+// TLSConfig configures a custom CA and a client certificate for mutual TLS.
+// Every certificate is either PEM content or a path to a PEM file.
+type TLSConfig struct {
+	CA                 string `toml:"ca"`
+	CAFile             string `toml:"ca_file"`
+	Cert               string `toml:"cert"`
+	CertFile           string `toml:"cert_file"`
+	Key                string `toml:"key"`
+	KeyFile            string `toml:"key_file"`
+	ServerName         string `toml:"server_name"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+}
+
+type RetryConfig struct {
+	// Count of retries after the first attempt, 0 disables retries.
+	Count int `toml:"count"`
+	// WaitTime is the initial backoff, it doubles on every attempt and gets
+	// a random jitter. Default: 100ms
+	WaitTime time.Duration `toml:"wait_time"`
+	// MaxWaitTime caps the backoff. Default: 2s
+	MaxWaitTime time.Duration `toml:"max_wait_time"`
+	// StatusCodes to retry on. Default: 429 and 5xx except 501
+	StatusCodes []int `toml:"status_codes"`
+	// NonIdempotent allows retries of POST and PATCH requests.
+	NonIdempotent bool `toml:"non_idempotent"`
+}
+
+type CircuitBreakerConfig struct {
+	Enabled bool `toml:"enabled"`
+	// FailureThreshold is the number of consecutive failures of a host that
+	// opens its breaker. Default: 5
+	FailureThreshold int `toml:"failure_threshold"`
+	// SuccessThreshold is the number of successes in half-open state that
+	// close the breaker. Default: 1
+	SuccessThreshold int `toml:"success_threshold"`
+	// OpenTimeout is how long the breaker stays open before a trial request
+	// is let through. Default: 10s
+	OpenTimeout time.Duration `toml:"open_timeout"`
+}
+
+// Configs is a backend per named table, e.g. [http.users] with [http.users.retry].
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
 }
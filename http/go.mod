@@ -4,9 +4,20 @@ go 1.23.4
 
 require resty.dev/v3 v3.0.0-beta.1
 
-require github.com/ihatiko/go-chef-core-sdk v0.0.1
+require (
+	github.com/ihatiko/go-chef-core-sdk v0.0.1
+	go.opentelemetry.io/otel v1.34.0
+	go.opentelemetry.io/otel/metric v1.34.0
+	go.opentelemetry.io/otel/trace v1.34.0
+	golang.org/x/oauth2 v0.25.0
+)
 
-require golang.org/x/net v0.35.0 // indirect
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
 
 replace (
 	github.com/ihatiko/go-chef-core-sdk v0.0.1 => ../../go-chef-core-sdk
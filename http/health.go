@@ -0,0 +1,121 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe is the result of the last health check.
+type Probe struct {
+	Time       time.Time     `json:"time"`
+	URL        string        `json:"url"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type probeStore struct {
+	mt   sync.Mutex
+	last *Probe
+}
+
+func (s *probeStore) set(probe Probe) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	s.last = &probe
+}
+
+func (s *probeStore) get() *Probe {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	return s.last
+}
+
+// healthURL resolves HealthHost against Health.Host; without Health.Host the
+// resty base URL is used.
+func (c Config) healthURL() string {
+	if c.Health.Host == "" {
+		return c.HealthHost
+	}
+	if strings.Contains(c.HealthHost, "://") {
+		return c.HealthHost
+	}
+	return strings.TrimRight(c.Health.Host, "/") + "/" + strings.TrimLeft(c.HealthHost, "/")
+}
+
+func (c *Client) liveness(ctx context.Context) error {
+	probe := Probe{Time: time.Now(), URL: c.config.healthURL()}
+	err := c.probe(ctx, &probe)
+	probe.Duration = time.Since(probe.Time)
+	if err != nil {
+		probe.Error = err.Error()
+	}
+	c.probes.set(probe)
+	return err
+}
+
+func (c *Client) probe(ctx context.Context, probe *Probe) error {
+	if c.probeClient == nil {
+		return c.Init.Error
+	}
+	health := c.config.Health
+	response, err := c.probeClient.
+		NewRequest().
+		SetContext(ctx).
+		SetTimeout(health.Timeout).
+		SetResponseBodyUnlimitedReads(true).
+		Execute(health.Method, probe.URL)
+	if err != nil {
+		return err
+	}
+	probe.StatusCode = response.StatusCode()
+	if !health.expected(response.StatusCode()) {
+		return fmt.Errorf("error check component status code: %d", response.StatusCode())
+	}
+	if len(health.Assertions) == 0 {
+		return nil
+	}
+	body := map[string]any{}
+	if err := json.Unmarshal(response.Bytes(), &body); err != nil {
+		return fmt.Errorf("error check component body: %w", err)
+	}
+	for path, expected := range health.Assertions {
+		actual, ok := lookup(body, path)
+		if !ok {
+			return fmt.Errorf("error check component body: %s is missing", path)
+		}
+		if fmt.Sprint(actual) != expected {
+			return fmt.Errorf("error check component body: %s == %v, expected %s", path, actual, expected)
+		}
+	}
+	return nil
+}
+
+func (c HealthConfig) expected(statusCode int) bool {
+	if len(c.ExpectedStatus) == 0 {
+		return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+	}
+	return slices.Contains(c.ExpectedStatus, statusCode)
+}
+
+// lookup resolves a dot separated path like "checks.db.status".
+func lookup(body map[string]any, path string) (any, bool) {
+	var node any = body
+	for _, part := range strings.Split(path, ".") {
+		fields, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		node, ok = fields[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
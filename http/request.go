@@ -0,0 +1,136 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"resty.dev/v3"
+)
+
+const defaultRequestIDHeader = "X-Request-Id"
+
+// ResponseError is returned by the typed helpers for non-2xx responses.
+type ResponseError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       []byte
+	RequestID  string
+	// Detail is the decoded error body when WithError was used.
+	Detail any
+}
+
+func (e *ResponseError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s %s: status code %d, request id %s: %s", e.Method, e.URL, e.StatusCode, e.RequestID, e.Body)
+	}
+	return fmt.Sprintf("%s %s: status code %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// RequestOption customizes a request made by the typed helpers.
+type RequestOption func(request *resty.Request)
+
+func WithQuery(key, value string) RequestOption {
+	return func(request *resty.Request) {
+		request.SetQueryParam(key, value)
+	}
+}
+
+func WithQueryParams(params map[string]string) RequestOption {
+	return func(request *resty.Request) {
+		request.SetQueryParams(params)
+	}
+}
+
+// WithPathParam fills "{key}" in the request path.
+func WithPathParam(key, value string) RequestOption {
+	return func(request *resty.Request) {
+		request.SetPathParam(key, value)
+	}
+}
+
+func WithPathParams(params map[string]string) RequestOption {
+	return func(request *resty.Request) {
+		request.SetPathParams(params)
+	}
+}
+
+func WithHeader(key, value string) RequestOption {
+	return func(request *resty.Request) {
+		request.SetHeader(key, value)
+	}
+}
+
+// WithError decodes a non-2xx response body into E, available as
+// ResponseError.Detail.
+func WithError[E any]() RequestOption {
+	return func(request *resty.Request) {
+		request.SetError(new(E))
+	}
+}
+
+func Get[Res any](ctx context.Context, c *Client, path string, opts ...RequestOption) (Res, error) {
+	return Do[Res](ctx, c, http.MethodGet, path, nil, opts...)
+}
+
+func Delete[Res any](ctx context.Context, c *Client, path string, opts ...RequestOption) (Res, error) {
+	return Do[Res](ctx, c, http.MethodDelete, path, nil, opts...)
+}
+
+func Post[Req, Res any](ctx context.Context, c *Client, path string, body Req, opts ...RequestOption) (Res, error) {
+	return Do[Res](ctx, c, http.MethodPost, path, body, opts...)
+}
+
+func Put[Req, Res any](ctx context.Context, c *Client, path string, body Req, opts ...RequestOption) (Res, error) {
+	return Do[Res](ctx, c, http.MethodPut, path, body, opts...)
+}
+
+func Patch[Req, Res any](ctx context.Context, c *Client, path string, body Req, opts ...RequestOption) (Res, error) {
+	return Do[Res](ctx, c, http.MethodPatch, path, body, opts...)
+}
+
+// Do sends a JSON request and decodes a 2xx response into Res. A nil body
+// sends no body.
+func Do[Res any](ctx context.Context, c *Client, method, path string, body any, opts ...RequestOption) (Res, error) {
+	var result Res
+	if c.client == nil {
+		return result, c.Init.Error
+	}
+	request := c.client.R().
+		SetContext(ctx).
+		SetResult(&result).
+		SetResponseBodyUnlimitedReads(true)
+	if body != nil {
+		request.SetBody(body)
+	}
+	for _, opt := range opts {
+		opt(request)
+	}
+	response, err := request.Execute(method, path)
+	if err != nil {
+		return result, err
+	}
+	if !response.IsSuccess() {
+		return result, c.responseError(response)
+	}
+	return result, nil
+}
+
+func (c *Client) responseError(response *resty.Response) *ResponseError {
+	header := c.config.RequestIDHeader
+	if header == "" {
+		header = defaultRequestIDHeader
+	}
+	requestID := response.Header().Get(header)
+	if requestID == "" {
+		requestID = response.Request.Header.Get(header)
+	}
+	return &ResponseError{
+		Method:     response.Request.Method,
+		URL:        response.Request.URL,
+		StatusCode: response.StatusCode(),
+		Body:       response.Bytes(),
+		RequestID:  requestID,
+		Detail:     response.Error(),
+	}
+}
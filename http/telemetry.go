@@ -0,0 +1,126 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"resty.dev/v3"
+	"strings"
+	"time"
+)
+
+const instrumentationName = "github.com/ihatiko/go-chef-clients-providers/http"
+
+type routeKey struct{}
+
+// routeMiddleware keeps the URL template (e.g. "/users/{id}") before resty
+// substitutes path params, so spans and metrics are not labelled per id.
+func routeMiddleware(_ *resty.Client, request *resty.Request) error {
+	request.SetContext(context.WithValue(request.Context(), routeKey{}, routeTemplate(request.URL)))
+	return nil
+}
+
+func routeTemplate(rawURL string) string {
+	if _, rest, ok := strings.Cut(rawURL, "://"); ok {
+		rawURL = "/"
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rawURL = rest[i:]
+		}
+	}
+	route, _, _ := strings.Cut(rawURL, "?")
+	if route == "" {
+		route = "/"
+	}
+	return route
+}
+
+// telemetryTransport creates a client span per attempt, propagates the trace
+// context and records request duration.
+type telemetryTransport struct {
+	next       http.RoundTripper
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	duration   metric.Float64Histogram
+}
+
+func newTelemetryTransport(next http.RoundTripper, cfg TelemetryConfig) (*telemetryTransport, error) {
+	transport := &telemetryTransport{
+		next:       next,
+		propagator: otel.GetTextMapPropagator(),
+	}
+	if !cfg.DisableTracing {
+		transport.tracer = otel.Tracer(instrumentationName)
+	}
+	if !cfg.DisableMetrics {
+		options := []metric.Float64HistogramOption{
+			metric.WithUnit("s"),
+			metric.WithDescription("Duration of outbound HTTP requests."),
+		}
+		if len(cfg.Buckets) > 0 {
+			options = append(options, metric.WithExplicitBucketBoundaries(cfg.Buckets...))
+		}
+		duration, err := otel.GetMeterProvider().Meter(instrumentationName).
+			Float64Histogram("http.client.request.duration", options...)
+		if err != nil {
+			return nil, err
+		}
+		transport.duration = duration
+	}
+	return transport, nil
+}
+
+func (t *telemetryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	route, _ := ctx.Value(routeKey{}).(string)
+	if route == "" {
+		route = request.URL.Path
+	}
+	attributes := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(request.Method),
+		semconv.ServerAddress(request.URL.Hostname()),
+		semconv.HTTPRoute(route),
+	}
+	var span trace.Span
+	if t.tracer != nil {
+		ctx, span = t.tracer.Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...),
+			trace.WithAttributes(semconv.URLFull(request.URL.String())),
+		)
+		defer span.End()
+	}
+	request = request.Clone(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
+	elapsed := time.Since(start)
+
+	switch {
+	case err != nil:
+		attributes = append(attributes, semconv.ErrorTypeKey.String(fmt.Sprintf("%T", err)))
+		if span != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	default:
+		attributes = append(attributes, semconv.HTTPResponseStatusCode(response.StatusCode))
+		if span != nil {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+			if response.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+			}
+		}
+	}
+	if t.duration != nil {
+		t.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attributes...))
+	}
+	return response, err
+}
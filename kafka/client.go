@@ -6,12 +6,10 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"github.com/bytedance/sonic"
 	"github.com/ihatiko/go-chef-core-sdk/store"
 	"github.com/ihatiko/go-chef-core-sdk/types"
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl/plain"
-	"go.opentelemetry.io/otel"
 	"sync"
 	"time"
 )
@@ -19,26 +17,36 @@ import (
 type IClient interface {
 	Produce(ctx context.Context, data ...any) error
 	ProduceByPartitionKey(ctx context.Context, key string, data ...any) error
+	ProduceMessages(ctx context.Context, messages ...Message) error
 }
 type Client struct {
 	types.Component
-	config Config
-	writer *kafka.Writer
+	config     Config
+	writer     *kafka.Writer
+	serializer Serializer
+	encoder    *schemaEncoder
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.config.Name == "" {
+		return key
+	}
+	return key + "." + c.config.Name
 }
 
 type Details struct {
-	Hosts []string `json:"hosts"`
-	Topic string   `json:"topic"`
+	Name   string   `json:"name,omitempty"`
+	Hosts  []string `json:"hosts"`
+	Topic  string   `json:"topic"`
+	Format string   `json:"format"`
 }
 
 func (c *Client) Details() any {
 	details := Details{}
+	details.Name = c.config.Name
 	details.Hosts = c.config.Hosts
 	details.Topic = c.config.Topic
+	details.Format = c.config.Format
 	return details
 }
 
@@ -47,6 +55,9 @@ const (
 )
 
 func (c *Client) Live(ctx context.Context) error {
+	if c.writer == nil {
+		return c.Init.Error
+	}
 	return c.checkKafkaConnectivity(ctx)
 }
 func (c *Client) Connection() IClient {
@@ -56,19 +67,23 @@ func (c *Client) Connection() IClient {
 }
 
 func (c *Client) getDialer() *kafka.Dialer {
+	return newDialer(c.config.DialTimeout, c.config.Login, c.config.Password, c.config.PEM)
+}
+
+func newDialer(timeout time.Duration, login, password, pem string) *kafka.Dialer {
 	dialer := &kafka.Dialer{
-		Timeout:   c.config.DialTimeout,
+		Timeout:   timeout,
 		DualStack: true,
 	}
-	if c.config.Login != "" {
+	if login != "" {
 		mechanism := &plain.Mechanism{
-			Username: c.config.Login, Password: c.config.Password,
+			Username: login, Password: password,
 		}
 		dialer.SASLMechanism = mechanism
 	}
-	if c.config.PEM != "" {
+	if pem != "" {
 		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM([]byte(c.config.PEM))
+		caCertPool.AppendCertsFromPEM([]byte(pem))
 
 		// Create a TLS configuration.
 		tlsConfig := &tls.Config{
@@ -79,20 +94,29 @@ func (c *Client) getDialer() *kafka.Dialer {
 	return dialer
 }
 func (c *Client) checkKafkaConnectivity(ctx context.Context) error {
+	return checkKafkaConnectivity(ctx, c.config.Hosts, c.getDialer())
+}
+
+func checkKafkaConnectivity(ctx context.Context, hosts []string, dialer *kafka.Dialer) error {
 	var errorsGroup []error
+	mt := &sync.Mutex{}
 	wg := &sync.WaitGroup{}
-	wg.Add(len(c.config.Hosts))
-	for _, addr := range c.config.Hosts {
+	wg.Add(len(hosts))
+	for _, addr := range hosts {
 		go func(addr string) {
 			defer wg.Done()
-			_, err := c.getDialer().DialContext(ctx, "tcp", addr)
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
 			if err != nil {
+				mt.Lock()
 				errorsGroup = append(errorsGroup, err)
+				mt.Unlock()
+				return
 			}
+			_ = conn.Close()
 		}(addr)
 	}
 	wg.Wait()
-	percent := 1 - float32(len(errorsGroup))/float32(len(c.config.Hosts))
+	percent := 1 - float32(len(errorsGroup))/float32(len(hosts))
 	if percent > 0.6 {
 		return nil
 	}
@@ -100,10 +124,13 @@ func (c *Client) checkKafkaConnectivity(ctx context.Context) error {
 }
 
 func (c *Client) Shutdown() error {
+	if c.writer == nil {
+		return nil
+	}
 	return c.writer.Close()
 }
 func (c *Client) Produce(ctx context.Context, data ...any) error {
-	return c.innerProducer(ctx, "", data)
+	return c.innerProducer(ctx, "", data...)
 }
 
 // HeaderCarrier is a custom type to adapt []kafka.Header to propagation.TextMapCarrier.
@@ -137,36 +164,42 @@ func (c *HeaderCarrier) Keys() []string {
 }
 
 func (c *Client) innerProducer(ctx context.Context, key string, data ...any) error {
-	messages := make([]kafka.Message, len(data))
-	var headers HeaderCarrier
-	otel.GetTextMapPropagator().Inject(ctx, &headers)
+	messages := make([]Message, len(data))
 	for i := range data {
-		output, err := sonic.Marshal(&data)
-		if err != nil {
-			return err
-		}
-		messages[i] = kafka.Message{
-			Value:   output,
-			Key:     []byte(key),
-			Headers: headers,
+		messages[i] = Message{
+			Key:   key,
+			Value: data[i],
 		}
 	}
-	if len(messages) == 0 {
-		return nil
-	}
-	return c.writer.WriteMessages(ctx, messages...)
+	return c.ProduceMessages(ctx, messages...)
 }
 func (c *Client) ProduceByPartitionKey(ctx context.Context, key string, data ...any) error {
-	return c.innerProducer(ctx, key, data)
+	return c.innerProducer(ctx, key, data...)
 }
 func (c *Config) New() *Client {
 	client := new(Client)
+	if c.Format == "" {
+		c.Format = FormatJSON
+	}
 	client.config = *c
 	if len(client.config.Hosts) == 0 {
 		client.Init.Error = errors.New("no hosts provided")
 		store.PackageStore.Load(client)
 		return client
 	}
+	serializer, err := c.newSerializer()
+	if err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
+	client.serializer = serializer
+	client.encoder, err = c.newSchemaEncoder()
+	if err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
 	client.writer = c.newWriter()
 	client.Ping(c.DialTimeout, client.Live)
 	return client
@@ -204,7 +237,6 @@ func (c *Config) newWriter() *kafka.Writer {
 	}
 	writer := &kafka.Writer{
 		Addr:                   kafka.TCP(c.Hosts...),
-		Topic:                  c.Topic,
 		AllowAutoTopicCreation: c.AllowAutoTopicCreation,
 		Transport:              transport,
 		Compression:            kafka.Snappy,
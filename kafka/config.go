@@ -3,13 +3,14 @@ package kafka
 import "time"
 
 type Config struct {
+	Name string `toml:"name"`
+
 	AllowAutoTopicCreation bool     `toml:"allow_auto_topic_creation"`
 	Hosts                  []string `toml:"hosts"` // Brokers
 	// Topic is the name of the topic that the writer will produce messages to.
 	//
-	// Setting this field or not is a mutually exclusive option. If you set Topic
-	// here, you must not set Topic for any produced Message. Otherwise, if you	do
-	// not set Topic, every Message must have Topic specified.
+	// It is used for every produced Message that has no Topic specified. If you
+	// do not set Topic, every Message must have Topic specified.
 	Topic string `toml:"topic"` // Topics to write data
 
 	// Limit on how many attempts will be made to deliver a message.
@@ -100,4 +101,101 @@ type Config struct {
 	Login       string        `toml:"login"`
 	Password    string        `toml:"password"`
 	PEM         string        `toml:"pem"`
+
+	// Format selects how message values are encoded, the following values are
+	// supported: json, protobuf, avro, raw.
+	//
+	// Defaults to json.
+	Format string `toml:"format"`
+	// AvroSchema is the schema used to encode values when Format is avro.
+	AvroSchema string `toml:"avro_schema"`
+	// Serializer overrides Format with a custom implementation.
+	Serializer Serializer `toml:"-"`
+
+	// SchemaRegistry enables the schema registry wire format: every value is
+	// prefixed with the magic byte and the id of the schema registered for
+	// the "<topic>-value" subject.
+	SchemaRegistry *SchemaRegistryConfig `toml:"schema_registry"`
+}
+
+type SchemaRegistryConfig struct {
+	Host     string `toml:"host"`
+	Login    string `toml:"login"`
+	Password string `toml:"password"`
+	// Timeout for requests to the registry.
+	//
+	// Defaults to 5s.
+	Timeout time.Duration `toml:"timeout"`
+	// AutoRegister registers the schema on first use instead of only looking
+	// it up.
+	AutoRegister bool `toml:"auto_register"`
+	// Schema is the schema for json and protobuf formats. The avro format
+	// registers AvroSchema, Schema may only repeat it.
+	Schema string `toml:"schema"`
+	// Registry overrides Host, e.g. with NewInMemorySchemaRegistry in tests.
+	Registry SchemaRegistry `toml:"-"`
+}
+
+type ConsumerConfig struct {
+	Name string `toml:"name"`
+
+	Hosts []string `toml:"hosts"` // Brokers
+	// GroupID holds the consumer group id. Offsets are committed to the group
+	// and partitions are balanced between the group members.
+	GroupID string `toml:"group_id"`
+	// Topics to read data from. All of them are consumed by the same group.
+	Topics []string `toml:"topics"`
+
+	// StartOffset determines from whence the consumer group should begin
+	// consuming when it finds a partition without a committed offset.
+	// Supported values are "first" and "last".
+	//
+	// Default: first
+	StartOffset string `toml:"start_offset"`
+
+	// CommitInterval indicates the interval at which offsets are committed to
+	// the broker. If 0, commits will be handled synchronously.
+	//
+	// Default: 0
+	CommitInterval time.Duration `toml:"commit_interval"`
+
+	// MinBytes indicates to the broker the minimum batch size that the consumer
+	// will accept.
+	//
+	// Default: 1
+	MinBytes int `toml:"min_bytes"`
+
+	// MaxBytes indicates to the broker the maximum batch size that the consumer
+	// will accept.
+	//
+	// Default: 1MB
+	MaxBytes int `toml:"max_bytes"`
+
+	// Maximum amount of time to wait for new data to come when fetching batches
+	// of messages from kafka.
+	//
+	// Default: 10s
+	MaxWait time.Duration `toml:"max_wait"`
+
+	// Time limit set for establishing connections to the kafka cluster.
+	//
+	// Defaults to 5s.
+	DialTimeout time.Duration `toml:"dial_timeout"`
+	Login       string        `toml:"login"`
+	Password    string        `toml:"password"`
+	PEM         string        `toml:"pem"`
+}
+
+// Configs is a producer per named table, e.g. [producer.orders].
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
 }
@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/ihatiko/go-chef-core-sdk/types"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	consumerKey = "kafka-consumer"
+
+	startOffsetFirst = "first"
+	startOffsetLast  = "last"
+)
+
+type Handler func(ctx context.Context, message kafka.Message) error
+
+type IConsumer interface {
+	Consume(ctx context.Context, handler Handler) error
+}
+
+type Consumer struct {
+	types.Component
+	config ConsumerConfig
+	reader *kafka.Reader
+
+	mt    sync.Mutex
+	stats ConsumerStats
+}
+
+// ConsumerStats accumulates the reader counters, kafka.Reader resets them on
+// every read.
+type ConsumerStats struct {
+	Messages   int64 `json:"messages"`
+	Bytes      int64 `json:"bytes"`
+	Errors     int64 `json:"errors"`
+	Rebalances int64 `json:"rebalances"`
+	Lag        int64 `json:"lag"`
+	Offset     int64 `json:"offset"`
+}
+
+func (c *Consumer) GetKey() string {
+	if c.config.Name == "" {
+		return consumerKey
+	}
+	return consumerKey + "." + c.config.Name
+}
+
+type ConsumerDetails struct {
+	Hosts   []string      `json:"hosts"`
+	GroupID string        `json:"group_id"`
+	Topics  []string      `json:"topics"`
+	Stats   ConsumerStats `json:"stats"`
+}
+
+func (c *Consumer) Details() any {
+	details := ConsumerDetails{}
+	details.Hosts = c.config.Hosts
+	details.GroupID = c.config.GroupID
+	details.Topics = c.config.Topics
+	details.Stats = c.Stats()
+	return details
+}
+
+// Stats is the only place reading kafka.Reader stats, so counters are not
+// lost between callers.
+func (c *Consumer) Stats() ConsumerStats {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	if c.reader == nil {
+		return c.stats
+	}
+	stats := c.reader.Stats()
+	c.stats.Messages += stats.Messages
+	c.stats.Bytes += stats.Bytes
+	c.stats.Errors += stats.Errors
+	c.stats.Rebalances += stats.Rebalances
+	c.stats.Lag = stats.Lag
+	c.stats.Offset = stats.Offset
+	return c.stats
+}
+
+func (c *Consumer) Live(ctx context.Context) error {
+	return checkKafkaConnectivity(ctx, c.config.Hosts, c.getDialer())
+}
+
+func (c *Consumer) Shutdown() error {
+	if c.reader == nil {
+		return nil
+	}
+	return c.reader.Close()
+}
+
+func (c *Consumer) Connection() IConsumer {
+	defer store.PackageStore.Load(c)
+	c.AwaitPing()
+	return c
+}
+
+func (c *Consumer) getDialer() *kafka.Dialer {
+	return newDialer(c.config.DialTimeout, c.config.Login, c.config.Password, c.config.PEM)
+}
+
+// Consume reads messages until ctx is cancelled or the consumer is closed.
+// The trace context is extracted from the message headers before the handler
+// is called, and the message offset is committed only when the handler succeeds.
+func (c *Consumer) Consume(ctx context.Context, handler Handler) error {
+	if c.reader == nil {
+		return c.Init.Error
+	}
+	for {
+		message, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		headers := HeaderCarrier(message.Headers)
+		messageCtx := otel.GetTextMapPropagator().Extract(ctx, &headers)
+		if err := handler(messageCtx, message); err != nil {
+			return fmt.Errorf("handle message topic=%s partition=%d offset=%d: %w",
+				message.Topic, message.Partition, message.Offset, err)
+		}
+		if err := c.reader.CommitMessages(ctx, message); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *ConsumerConfig) New() *Consumer {
+	consumer := new(Consumer)
+	if c.DialTimeout == 0 {
+		c.DialTimeout = time.Second * 5
+	}
+	consumer.config = *c
+	if len(c.Hosts) == 0 {
+		consumer.Init.Error = errors.New("no hosts provided")
+		store.PackageStore.Load(consumer)
+		return consumer
+	}
+	if c.GroupID == "" {
+		consumer.Init.Error = errors.New("no group id provided")
+		store.PackageStore.Load(consumer)
+		return consumer
+	}
+	if len(c.Topics) == 0 {
+		consumer.Init.Error = errors.New("no topics provided")
+		store.PackageStore.Load(consumer)
+		return consumer
+	}
+	readerConfig := kafka.ReaderConfig{
+		Brokers:        c.Hosts,
+		GroupID:        c.GroupID,
+		GroupTopics:    c.Topics,
+		Dialer:         consumer.getDialer(),
+		CommitInterval: c.CommitInterval,
+		StartOffset:    kafka.FirstOffset,
+	}
+	switch c.StartOffset {
+	case "", startOffsetFirst:
+	case startOffsetLast:
+		readerConfig.StartOffset = kafka.LastOffset
+	default:
+		consumer.Init.Error = fmt.Errorf("unknown start offset: %s", c.StartOffset)
+		store.PackageStore.Load(consumer)
+		return consumer
+	}
+	if c.MinBytes > 0 {
+		readerConfig.MinBytes = c.MinBytes
+	}
+	if c.MaxBytes > 0 {
+		readerConfig.MaxBytes = c.MaxBytes
+	}
+	if c.MaxWait > 0 {
+		readerConfig.MaxWait = c.MaxWait
+	}
+	consumer.reader = kafka.NewReader(readerConfig)
+	consumer.Ping(c.DialTimeout, consumer.Live)
+	return consumer
+}
@@ -4,9 +4,11 @@ go 1.23.4
 
 require (
 	github.com/bytedance/sonic v1.12.8
+	github.com/hamba/avro/v2 v2.27.0
 	github.com/ihatiko/go-chef-core-sdk v0.0.1
 	github.com/segmentio/kafka-go v0.4.47
 	go.opentelemetry.io/otel v1.34.0
+	google.golang.org/protobuf v1.36.3
 )
 
 require (
@@ -14,8 +16,12 @@ require (
 	github.com/cloudwego/base64x v0.1.5 // indirect
 	github.com/go-logr/logr v1.4.2 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.9 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pierrec/lz4/v4 v4.1.22 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
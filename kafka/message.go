@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"strings"
+	"time"
+)
+
+// Message is a single record to produce. Value is marshalled on its own,
+// Topic falls back to Config.Topic and Time to the moment of writing.
+type Message struct {
+	Key     string
+	Value   any
+	Headers map[string]string
+	Topic   string
+	Time    time.Time
+}
+
+// MessageError describes a message that was not produced.
+type MessageError struct {
+	Index   int
+	Message Message
+	Err     error
+}
+
+func (e MessageError) Error() string {
+	return fmt.Sprintf("message %d: %s", e.Index, e.Err)
+}
+
+func (e MessageError) Unwrap() error {
+	return e.Err
+}
+
+// ProduceError is returned by ProduceMessages when some of the messages failed.
+// Messages that are not listed were written successfully, so callers can retry
+// only Failed().
+type ProduceError struct {
+	Errors []MessageError
+}
+
+func (e *ProduceError) Error() string {
+	errs := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		errs[i] = e.Errors[i].Error()
+	}
+	return fmt.Sprintf("kafka produce errors (%d): %s", len(e.Errors), strings.Join(errs, "; "))
+}
+
+func (e *ProduceError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i := range e.Errors {
+		errs[i] = e.Errors[i]
+	}
+	return errs
+}
+
+// Failed returns the messages that have to be produced again.
+func (e *ProduceError) Failed() []Message {
+	messages := make([]Message, len(e.Errors))
+	for i := range e.Errors {
+		messages[i] = e.Errors[i].Message
+	}
+	return messages
+}
+
+func (c *Client) ProduceMessages(ctx context.Context, messages ...Message) error {
+	if c.writer == nil {
+		return c.Init.Error
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	var traceHeaders HeaderCarrier
+	otel.GetTextMapPropagator().Inject(ctx, &traceHeaders)
+
+	produceError := new(ProduceError)
+	kafkaMessages := make([]kafka.Message, 0, len(messages))
+	indexes := make([]int, 0, len(messages))
+	for i, message := range messages {
+		kafkaMessage, err := c.toKafkaMessage(ctx, message, traceHeaders)
+		if err != nil {
+			produceError.Errors = append(produceError.Errors, MessageError{Index: i, Message: message, Err: err})
+			continue
+		}
+		kafkaMessages = append(kafkaMessages, kafkaMessage)
+		indexes = append(indexes, i)
+	}
+	if len(kafkaMessages) > 0 {
+		err := c.writer.WriteMessages(ctx, kafkaMessages...)
+		var writeErrors kafka.WriteErrors
+		switch {
+		case err == nil:
+		case errors.As(err, &writeErrors):
+			for i, writeError := range writeErrors {
+				if writeError == nil {
+					continue
+				}
+				index := indexes[i]
+				produceError.Errors = append(produceError.Errors, MessageError{Index: index, Message: messages[index], Err: writeError})
+			}
+		default:
+			for _, index := range indexes {
+				produceError.Errors = append(produceError.Errors, MessageError{Index: index, Message: messages[index], Err: err})
+			}
+		}
+	}
+	if len(produceError.Errors) == 0 {
+		return nil
+	}
+	return produceError
+}
+
+func (c *Client) toKafkaMessage(ctx context.Context, message Message, traceHeaders HeaderCarrier) (kafka.Message, error) {
+	topic := message.Topic
+	if topic == "" {
+		topic = c.config.Topic
+	}
+	if topic == "" {
+		return kafka.Message{}, errors.New("no topic provided")
+	}
+	output, err := c.serializer.Serialize(message.Value)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	if c.encoder != nil {
+		output, err = c.encoder.encode(ctx, topic, output)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+	}
+	headers := make(HeaderCarrier, 0, len(traceHeaders)+len(message.Headers)+1)
+	headers = append(headers, traceHeaders...)
+	if _, ok := message.Headers[contentTypeHeader]; !ok {
+		headers.Set(contentTypeHeader, c.serializer.ContentType())
+	}
+	for key, value := range message.Headers {
+		headers.Set(key, value)
+	}
+	kafkaMessage := kafka.Message{
+		Topic:   topic,
+		Value:   output,
+		Headers: headers,
+		Time:    message.Time,
+	}
+	if message.Key != "" {
+		kafkaMessage.Key = []byte(message.Key)
+	}
+	return kafkaMessage, nil
+}
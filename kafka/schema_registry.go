@@ -0,0 +1,363 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hamba/avro/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	magicByte      = 0
+	wireHeaderSize = 5
+
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeJSON     = "JSON"
+	SchemaTypeProtobuf = "PROTOBUF"
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+	defaultRegistryTimeout    = 5 * time.Second
+)
+
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// SchemaRegistry is a Confluent compatible schema registry.
+type SchemaRegistry interface {
+	// Register registers schema under subject and returns its id. Registering
+	// an already known schema returns the existing id.
+	Register(ctx context.Context, subject, schemaType, schema string) (int, error)
+	// Lookup returns the id of schema registered under subject.
+	Lookup(ctx context.Context, subject, schemaType, schema string) (int, error)
+	// Schema returns the schema registered with id.
+	Schema(ctx context.Context, id int) (string, error)
+}
+
+// EncodeWireFormat prefixes payload with the magic byte and the schema id.
+func EncodeWireFormat(schemaID int, payload []byte) []byte {
+	output := make([]byte, wireHeaderSize, wireHeaderSize+len(payload))
+	output[0] = magicByte
+	binary.BigEndian.PutUint32(output[1:wireHeaderSize], uint32(schemaID))
+	return append(output, payload...)
+}
+
+// DecodeWireFormat splits data produced by EncodeWireFormat.
+func DecodeWireFormat(data []byte) (int, []byte, error) {
+	if len(data) < wireHeaderSize || data[0] != magicByte {
+		return 0, nil, errors.New("invalid schema registry wire format")
+	}
+	return int(binary.BigEndian.Uint32(data[1:wireHeaderSize])), data[wireHeaderSize:], nil
+}
+
+type schemaKey struct {
+	subject string
+	schema  string
+}
+
+// CachedSchemaRegistry keeps resolved ids and schemas in memory so the
+// underlying registry is asked only once per subject and schema.
+type CachedSchemaRegistry struct {
+	registry SchemaRegistry
+	mt       sync.RWMutex
+	ids      map[schemaKey]int
+	schemas  map[int]string
+}
+
+func NewCachedSchemaRegistry(registry SchemaRegistry) *CachedSchemaRegistry {
+	return &CachedSchemaRegistry{
+		registry: registry,
+		ids:      map[schemaKey]int{},
+		schemas:  map[int]string{},
+	}
+}
+
+func (r *CachedSchemaRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	return r.resolve(ctx, subject, schema, func() (int, error) {
+		return r.registry.Register(ctx, subject, schemaType, schema)
+	})
+}
+
+func (r *CachedSchemaRegistry) Lookup(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	return r.resolve(ctx, subject, schema, func() (int, error) {
+		return r.registry.Lookup(ctx, subject, schemaType, schema)
+	})
+}
+
+func (r *CachedSchemaRegistry) resolve(ctx context.Context, subject, schema string, load func() (int, error)) (int, error) {
+	k := schemaKey{subject: subject, schema: schema}
+	r.mt.RLock()
+	id, ok := r.ids[k]
+	r.mt.RUnlock()
+	if ok {
+		return id, nil
+	}
+	id, err := load()
+	if err != nil {
+		return 0, err
+	}
+	r.mt.Lock()
+	r.ids[k] = id
+	r.schemas[id] = schema
+	r.mt.Unlock()
+	return id, nil
+}
+
+func (r *CachedSchemaRegistry) Schema(ctx context.Context, id int) (string, error) {
+	r.mt.RLock()
+	schema, ok := r.schemas[id]
+	r.mt.RUnlock()
+	if ok {
+		return schema, nil
+	}
+	schema, err := r.registry.Schema(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	r.mt.Lock()
+	r.schemas[id] = schema
+	r.mt.Unlock()
+	return schema, nil
+}
+
+// InMemorySchemaRegistry is a local stand-in for a schema registry.
+type InMemorySchemaRegistry struct {
+	mt      sync.Mutex
+	ids     map[schemaKey]int
+	schemas []string
+}
+
+func NewInMemorySchemaRegistry() *InMemorySchemaRegistry {
+	return &InMemorySchemaRegistry{
+		ids: map[schemaKey]int{},
+	}
+}
+
+func (r *InMemorySchemaRegistry) Register(_ context.Context, subject, _, schema string) (int, error) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	k := schemaKey{subject: subject, schema: schema}
+	if id, ok := r.ids[k]; ok {
+		return id, nil
+	}
+	for i := range r.schemas {
+		if r.schemas[i] == schema {
+			r.ids[k] = i + 1
+			return i + 1, nil
+		}
+	}
+	r.schemas = append(r.schemas, schema)
+	r.ids[k] = len(r.schemas)
+	return len(r.schemas), nil
+}
+
+func (r *InMemorySchemaRegistry) Lookup(_ context.Context, subject, _, schema string) (int, error) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	if id, ok := r.ids[schemaKey{subject: subject, schema: schema}]; ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("subject %s: %w", subject, ErrSchemaNotFound)
+}
+
+func (r *InMemorySchemaRegistry) Schema(_ context.Context, id int) (string, error) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	if id <= 0 || id > len(r.schemas) {
+		return "", fmt.Errorf("schema id %d: %w", id, ErrSchemaNotFound)
+	}
+	return r.schemas[id-1], nil
+}
+
+// HTTPSchemaRegistry talks to a Confluent schema registry over its REST API.
+type HTTPSchemaRegistry struct {
+	url      string
+	login    string
+	password string
+	client   *http.Client
+}
+
+func NewHTTPSchemaRegistry(cfg SchemaRegistryConfig) *HTTPSchemaRegistry {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultRegistryTimeout
+	}
+	return &HTTPSchemaRegistry{
+		url:      strings.TrimRight(cfg.Host, "/"),
+		login:    cfg.Login,
+		password: cfg.Password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type schemaResponse struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+func (r *HTTPSchemaRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	response := schemaResponse{}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := r.do(ctx, http.MethodPost, path, newSchemaRequest(schemaType, schema), &response); err != nil {
+		return 0, err
+	}
+	return response.ID, nil
+}
+
+func (r *HTTPSchemaRegistry) Lookup(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	response := schemaResponse{}
+	path := "/subjects/" + url.PathEscape(subject)
+	if err := r.do(ctx, http.MethodPost, path, newSchemaRequest(schemaType, schema), &response); err != nil {
+		return 0, err
+	}
+	return response.ID, nil
+}
+
+func (r *HTTPSchemaRegistry) Schema(ctx context.Context, id int) (string, error) {
+	response := schemaResponse{}
+	if err := r.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &response); err != nil {
+		return "", err
+	}
+	return response.Schema, nil
+}
+
+func newSchemaRequest(schemaType, schema string) *schemaRequest {
+	request := &schemaRequest{Schema: schema}
+	// AVRO is the registry default and is omitted for older registries.
+	if schemaType != SchemaTypeAvro {
+		request.SchemaType = schemaType
+	}
+	return request
+}
+
+func (r *HTTPSchemaRegistry) do(ctx context.Context, method, path string, body any, output any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, r.url+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", schemaRegistryContentType)
+	if body != nil {
+		request.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	if r.login != "" {
+		request.SetBasicAuth(r.login, r.password)
+	}
+	response, err := r.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", method, path, ErrSchemaNotFound)
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("schema registry %s %s status code: %d body: %s", method, path, response.StatusCode, data)
+	}
+	return json.Unmarshal(data, output)
+}
+
+// schemaEncoder resolves schema ids per topic and frames payloads.
+type schemaEncoder struct {
+	registry     SchemaRegistry
+	schemaType   string
+	schema       string
+	autoRegister bool
+}
+
+func (c *Config) newSchemaEncoder() (*schemaEncoder, error) {
+	cfg := c.SchemaRegistry
+	if cfg == nil {
+		return nil, nil
+	}
+	encoder := &schemaEncoder{
+		schema:       cfg.Schema,
+		autoRegister: cfg.AutoRegister,
+	}
+	switch c.Format {
+	case FormatAvro:
+		encoder.schemaType = SchemaTypeAvro
+		// the registered schema has to be the one values are encoded with
+		if encoder.schema != "" && !sameAvroSchema(encoder.schema, c.AvroSchema) {
+			return nil, errors.New("schema registry schema differs from avro_schema")
+		}
+		encoder.schema = c.AvroSchema
+	case FormatJSON:
+		encoder.schemaType = SchemaTypeJSON
+	case FormatProtobuf:
+		encoder.schemaType = SchemaTypeProtobuf
+	default:
+		return nil, fmt.Errorf("schema registry does not support format: %s", c.Format)
+	}
+	if encoder.schema == "" {
+		return nil, errors.New("schema registry requires a schema")
+	}
+	registry := cfg.Registry
+	if registry == nil {
+		if cfg.Host == "" {
+			return nil, errors.New("schema registry requires host or registry")
+		}
+		registry = NewHTTPSchemaRegistry(*cfg)
+	}
+	encoder.registry = NewCachedSchemaRegistry(registry)
+	return encoder, nil
+}
+
+// sameAvroSchema compares the canonical forms of two avro schemas.
+func sameAvroSchema(a, b string) bool {
+	schemaA, err := avro.Parse(a)
+	if err != nil {
+		return false
+	}
+	schemaB, err := avro.Parse(b)
+	if err != nil {
+		return false
+	}
+	return schemaA.Fingerprint() == schemaB.Fingerprint()
+}
+
+// encode uses the topic name strategy: the subject is "<topic>-value".
+func (e *schemaEncoder) encode(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	subject := topic + "-value"
+	var (
+		id  int
+		err error
+	)
+	if e.autoRegister {
+		id, err = e.registry.Register(ctx, subject, e.schemaType, e.schema)
+	} else {
+		id, err = e.registry.Lookup(ctx, subject, e.schemaType, e.schema)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.schemaType == SchemaTypeProtobuf {
+		// Message indexes: a single zero means the first message in the schema.
+		payload = append([]byte{0}, payload...)
+	}
+	return EncodeWireFormat(id, payload), nil
+}
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+const (
+	userSchema      = `{"type":"record","name":"User","fields":[{"name":"id","type":"long"}]}`
+	userSchemaSpace = `{"type": "record", "name": "User", "fields": [{"name": "id", "type": "long"}]}`
+	orderSchema     = `{"type":"record","name":"Order","fields":[{"name":"id","type":"long"}]}`
+)
+
+func TestInMemorySchemaRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := NewInMemorySchemaRegistry()
+
+	if _, err := registry.Lookup(ctx, "users-value", SchemaTypeAvro, userSchema); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("lookup of unknown schema: %v, expected ErrSchemaNotFound", err)
+	}
+	id, err := registry.Register(ctx, "users-value", SchemaTypeAvro, userSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := registry.Register(ctx, "users-value", SchemaTypeAvro, userSchema)
+	if err != nil || again != id {
+		t.Fatalf("register again = %d, %v, expected %d", again, err, id)
+	}
+	shared, err := registry.Register(ctx, "admins-value", SchemaTypeAvro, userSchema)
+	if err != nil || shared != id {
+		t.Fatalf("same schema under another subject = %d, %v, expected %d", shared, err, id)
+	}
+	other, err := registry.Register(ctx, "orders-value", SchemaTypeAvro, orderSchema)
+	if err != nil || other == id {
+		t.Fatalf("other schema = %d, %v, expected a new id", other, err)
+	}
+	found, err := registry.Lookup(ctx, "users-value", SchemaTypeAvro, userSchema)
+	if err != nil || found != id {
+		t.Fatalf("lookup = %d, %v, expected %d", found, err, id)
+	}
+	schema, err := registry.Schema(ctx, other)
+	if err != nil || schema != orderSchema {
+		t.Fatalf("schema = %q, %v, expected %q", schema, err, orderSchema)
+	}
+	if _, err := registry.Schema(ctx, 100); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("unknown id: %v, expected ErrSchemaNotFound", err)
+	}
+}
+
+type countingRegistry struct {
+	SchemaRegistry
+	calls int
+}
+
+func (r *countingRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	r.calls++
+	return r.SchemaRegistry.Register(ctx, subject, schemaType, schema)
+}
+
+func (r *countingRegistry) Schema(ctx context.Context, id int) (string, error) {
+	r.calls++
+	return r.SchemaRegistry.Schema(ctx, id)
+}
+
+func TestCachedSchemaRegistry(t *testing.T) {
+	ctx := context.Background()
+	counting := &countingRegistry{SchemaRegistry: NewInMemorySchemaRegistry()}
+	registry := NewCachedSchemaRegistry(counting)
+
+	id, err := registry.Register(ctx, "users-value", SchemaTypeAvro, userSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		cached, err := registry.Register(ctx, "users-value", SchemaTypeAvro, userSchema)
+		if err != nil || cached != id {
+			t.Fatalf("cached register = %d, %v, expected %d", cached, err, id)
+		}
+		if _, err := registry.Schema(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counting.calls != 1 {
+		t.Fatalf("underlying registry called %d times, expected 1", counting.calls)
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	payload := []byte("payload")
+	data := EncodeWireFormat(258, payload)
+	if !bytes.Equal(data[:wireHeaderSize], []byte{magicByte, 0, 0, 1, 2}) {
+		t.Fatalf("header = %v", data[:wireHeaderSize])
+	}
+	id, decoded, err := DecodeWireFormat(data)
+	if err != nil || id != 258 || !bytes.Equal(decoded, payload) {
+		t.Fatalf("decode = %d, %q, %v", id, decoded, err)
+	}
+	if _, _, err := DecodeWireFormat([]byte{1, 0, 0, 0, 1}); err == nil {
+		t.Fatal("expected an error for a wrong magic byte")
+	}
+	if _, _, err := DecodeWireFormat([]byte{magicByte, 0}); err == nil {
+		t.Fatal("expected an error for a short header")
+	}
+}
+
+func TestSchemaEncoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     Config
+		wantErr    bool
+		wantSchema string
+		prefix     []byte
+	}{
+		{
+			name:       "avro registers avro_schema",
+			config:     Config{Format: FormatAvro, AvroSchema: userSchema, SchemaRegistry: &SchemaRegistryConfig{AutoRegister: true}},
+			wantSchema: userSchema,
+		},
+		{
+			name:       "avro accepts the same schema",
+			config:     Config{Format: FormatAvro, AvroSchema: userSchema, SchemaRegistry: &SchemaRegistryConfig{AutoRegister: true, Schema: userSchemaSpace}},
+			wantSchema: userSchema,
+		},
+		{
+			name:    "avro rejects another schema",
+			config:  Config{Format: FormatAvro, AvroSchema: userSchema, SchemaRegistry: &SchemaRegistryConfig{AutoRegister: true, Schema: orderSchema}},
+			wantErr: true,
+		},
+		{
+			name:       "protobuf adds message indexes",
+			config:     Config{Format: FormatProtobuf, SchemaRegistry: &SchemaRegistryConfig{AutoRegister: true, Schema: "message User {}"}},
+			wantSchema: "message User {}",
+			prefix:     []byte{0},
+		},
+		{
+			name:    "json requires a schema",
+			config:  Config{Format: FormatJSON, SchemaRegistry: &SchemaRegistryConfig{AutoRegister: true}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewInMemorySchemaRegistry()
+			test.config.SchemaRegistry.Registry = registry
+			encoder, err := test.config.newSchemaEncoder()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := encoder.encode(context.Background(), "users", []byte("value"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, payload, err := DecodeWireFormat(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := append(test.prefix, "value"...); !bytes.Equal(payload, expected) {
+				t.Errorf("payload = %q, expected %q", payload, expected)
+			}
+			schema, err := registry.Schema(context.Background(), id)
+			if err != nil || schema != test.wantSchema {
+				t.Errorf("registered schema = %q, %v, expected %q", schema, err, test.wantSchema)
+			}
+			if _, err := registry.Lookup(context.Background(), "users-value", "", test.wantSchema); err != nil {
+				t.Errorf("subject users-value: %v", err)
+			}
+		})
+	}
+}
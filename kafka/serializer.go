@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytedance/sonic"
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeHeader = "content-type"
+
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+	FormatAvro     = "avro"
+	FormatRaw      = "raw"
+)
+
+// Serializer encodes message values before they are written to kafka.
+type Serializer interface {
+	Serialize(value any) ([]byte, error)
+	ContentType() string
+}
+
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(value any) ([]byte, error) {
+	return sonic.Marshal(value)
+}
+
+func (JSONSerializer) ContentType() string {
+	return "application/json"
+}
+
+// ProtobufSerializer accepts values implementing proto.Message.
+type ProtobufSerializer struct{}
+
+func (ProtobufSerializer) Serialize(value any) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf serializer: %T does not implement proto.Message", value)
+	}
+	return proto.Marshal(message)
+}
+
+func (ProtobufSerializer) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// AvroSerializer encodes values with a single avro schema.
+type AvroSerializer struct {
+	Schema avro.Schema
+}
+
+func NewAvroSerializer(schema string) (*AvroSerializer, error) {
+	parsed, err := avro.Parse(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSerializer{Schema: parsed}, nil
+}
+
+func (s *AvroSerializer) Serialize(value any) ([]byte, error) {
+	return avro.Marshal(s.Schema, value)
+}
+
+func (s *AvroSerializer) ContentType() string {
+	return "application/avro"
+}
+
+// RawSerializer passes pre-encoded payloads through untouched.
+type RawSerializer struct{}
+
+func (RawSerializer) Serialize(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case json.RawMessage:
+		return v, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("raw serializer: unsupported type %T", value)
+	}
+}
+
+func (RawSerializer) ContentType() string {
+	return "application/octet-stream"
+}
+
+func (c *Config) newSerializer() (Serializer, error) {
+	if c.Serializer != nil {
+		return c.Serializer, nil
+	}
+	switch c.Format {
+	case "", FormatJSON:
+		return JSONSerializer{}, nil
+	case FormatProtobuf:
+		return ProtobufSerializer{}, nil
+	case FormatAvro:
+		if c.AvroSchema == "" {
+			return nil, fmt.Errorf("avro format requires avro_schema")
+		}
+		return NewAvroSerializer(c.AvroSchema)
+	case FormatRaw:
+		return RawSerializer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown kafka format: %s", c.Format)
+	}
+}
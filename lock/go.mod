@@ -0,0 +1,3 @@
+module github.com/ihatiko/go-chef-clients-providers/lock
+
+go 1.23.4
@@ -0,0 +1,49 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned when the lock is held by someone else.
+	ErrNotAcquired = errors.New("lock not acquired")
+	// ErrLockLost is returned when the lock expired or was taken over.
+	ErrLockLost = errors.New("lock lost")
+)
+
+// Locker acquires distributed locks.
+type Locker interface {
+	// Acquire tries to take key once and returns ErrNotAcquired if it is held.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a held lock.
+type Lock interface {
+	Key() string
+	// Token is a fencing token that grows every time key is acquired. Pass it
+	// to the protected resource to reject writes from stale holders. It is 0
+	// when the locker cannot provide fencing.
+	Token() int64
+	// Refresh extends the lock to ttl or returns ErrLockLost.
+	Refresh(ctx context.Context, ttl time.Duration) error
+	Release(ctx context.Context) error
+}
+
+// Wait retries Acquire every interval until the lock is taken or ctx is done.
+func Wait(ctx context.Context, locker Locker, key string, ttl, interval time.Duration) (Lock, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		l, err := locker.Acquire(ctx, key, ttl)
+		if !errors.Is(err, ErrNotAcquired) {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Locker for tests and single instance services.
+type Memory struct {
+	mt     sync.Mutex
+	locks  map[string]*memoryLock
+	tokens map[string]int64
+	now    func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		locks:  map[string]*memoryLock{},
+		tokens: map[string]int64{},
+		now:    time.Now,
+	}
+}
+
+type memoryLock struct {
+	locker    *Memory
+	key       string
+	token     int64
+	expiresAt time.Time
+}
+
+func (m *Memory) Acquire(_ context.Context, key string, ttl time.Duration) (Lock, error) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	if held, ok := m.locks[key]; ok && m.now().Before(held.expiresAt) {
+		return nil, ErrNotAcquired
+	}
+	m.tokens[key]++
+	l := &memoryLock{
+		locker:    m,
+		key:       key,
+		token:     m.tokens[key],
+		expiresAt: m.now().Add(ttl),
+	}
+	m.locks[key] = l
+	return l, nil
+}
+
+func (l *memoryLock) Key() string {
+	return l.key
+}
+
+func (l *memoryLock) Token() int64 {
+	return l.token
+}
+
+func (l *memoryLock) Refresh(_ context.Context, ttl time.Duration) error {
+	m := l.locker
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	if m.locks[l.key] != l || !m.now().Before(l.expiresAt) {
+		return ErrLockLost
+	}
+	l.expiresAt = m.now().Add(ttl)
+	return nil
+}
+
+func (l *memoryLock) Release(_ context.Context) error {
+	m := l.locker
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	if m.locks[l.key] != l {
+		return ErrLockLost
+	}
+	delete(m.locks, l.key)
+	return nil
+}
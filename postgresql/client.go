@@ -3,19 +3,19 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/ihatiko/go-chef-core-sdk/types"
-	"log"
 	"time"
 
 	"github.com/ihatiko/go-chef-core-sdk/store"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/uptrace/opentelemetry-go-extra/otelsql"
-	"github.com/uptrace/opentelemetry-go-extra/otelsqlx"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/prometheus"
-	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
@@ -28,67 +28,58 @@ const (
 	connMaxIdleTime      = 20
 	defaultQueryExecMode = "simple_protocol"
 	defaultSslMode       = "disable"
+	defaultPort          = 5432
 )
 const (
 	key           = "postgres"
 	defaultDriver = "pgx"
+	meterName     = "github.com/ihatiko/go-chef-clients-providers/postgresql"
 )
 
-var metricProvider *metric.MeterProvider
-
-func getMetricProvider() *metric.MeterProvider {
-	if metricProvider == nil {
-		exporter, err := prometheus.New()
-		if err != nil {
-			log.Fatal(err)
-		}
-		metricProvider = metric.NewMeterProvider(metric.WithReader(exporter))
-	}
-
-	return metricProvider
-}
-
-func (c *Config) toPgConnection() string {
-	queryExecMode := c.QueryExecMode
-	if queryExecMode == "" {
-		queryExecMode = defaultQueryExecMode
-	}
-
-	dataSourceName := fmt.Sprintf("host=%s port=%d login=%s dbname=%s password=%s sslmode=%s default_query_exec_mode=%s",
-		c.Host,
-		c.Port,
-		c.Login,
-		c.Database,
-		c.Password,
-		c.SSLMode,
-		queryExecMode,
-	)
-	return dataSourceName
-}
-
 type Client struct {
 	types.Component
-	Db  *sqlx.DB
-	cfg *Config
+	Db       *sqlx.DB
+	pool     *pgxpool.Pool
+	cfg      *Config
+	migrator *Migrator
+	primary  *replica
+	replicas *replicaSet
+
+	txRetries metric.Int64Counter
+	stats     metric.Registration
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.cfg.Name == "" {
+		return key
+	}
+	return key + "." + c.cfg.Name
 }
 
 type Details struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Database string `json:"database"`
-	PgDriver string `json:"pg_driver"`
+	Name       string            `json:"name,omitempty"`
+	Host       string            `json:"host"`
+	Port       int               `json:"port"`
+	Database   string            `json:"database"`
+	PgDriver   string            `json:"pg_driver"`
+	Mode       string            `json:"mode"`
+	Migrations *MigrationDetails `json:"migrations,omitempty"`
+	Nodes      []NodeDetails     `json:"nodes,omitempty"`
 }
 
 func (c *Client) Details() any {
 	details := Details{}
+	details.Name = c.cfg.Name
 	details.Host = c.cfg.Host
 	details.Port = c.cfg.Port
 	details.Database = c.cfg.Database
 	details.PgDriver = c.cfg.PgDriver
+	details.Mode = c.cfg.Mode
+	if c.migrator != nil {
+		migrations := c.migrator.details()
+		details.Migrations = &migrations
+	}
+	details.Nodes = c.nodes()
 	return details
 }
 
@@ -96,11 +87,32 @@ func (c *Client) Live(ctx context.Context) error {
 	if c.Db == nil {
 		return c.Init.Error
 	}
-	return c.Db.PingContext(ctx)
+	start := time.Now()
+	var err error
+	if c.pool != nil {
+		err = c.pool.Ping(ctx)
+	} else {
+		err = c.Db.PingContext(ctx)
+	}
+	c.primary.record(time.Since(start), err)
+	return err
 }
 
 func (c *Client) Shutdown() error {
-	return c.Db.Close()
+	var errs []error
+	if c.stats != nil {
+		errs = append(errs, c.stats.Unregister())
+	}
+	if c.replicas != nil {
+		errs = append(errs, c.replicas.close())
+	}
+	if c.Db != nil {
+		errs = append(errs, c.Db.Close())
+	}
+	if c.pool != nil {
+		c.pool.Close()
+	}
+	return errors.Join(errs...)
 }
 
 func (c *Client) Connection() *sqlx.DB {
@@ -112,14 +124,32 @@ func (c *Client) Connection() *sqlx.DB {
 	return c.Db
 }
 
+// Migrator returns the migrator configured by AutoMigrate, or nil.
+func (c *Client) Migrator() *Migrator {
+	return c.migrator
+}
+
+func (c *Client) migrate() error {
+	source, err := c.cfg.migrationSource()
+	if err != nil {
+		return err
+	}
+	migrator, err := NewMigrator(c.Db, c.cfg.MigrationsTable, source)
+	if err != nil {
+		return err
+	}
+	c.migrator = migrator
+	return migrator.Up(context.Background())
+}
+
 func (c *Config) New() *Client {
 	client := new(Client)
 	client.cfg = c
 	if c.PgDriver == "" {
 		c.PgDriver = defaultDriver
 	}
-	if c.MaxIdleConnections == 0 {
-		c.MaxIdleConnections = maxOpenConnections
+	if c.MaxOpenConnections == 0 {
+		c.MaxOpenConnections = maxOpenConnections
 	}
 	if c.MaxIdleConnections == 0 {
 		c.MaxIdleConnections = maxIdleConnections
@@ -133,26 +163,107 @@ func (c *Config) New() *Client {
 	if c.SSLMode == "" {
 		c.SSLMode = defaultSslMode
 	}
-	connectionString := c.toPgConnection()
+	if c.Mode == "" {
+		c.Mode = modeSQL
+	}
+	if c.ReplicaBalancer == "" {
+		c.ReplicaBalancer = balancerRoundRobin
+	}
+	if c.ReplicaCheckInterval == 0 {
+		c.ReplicaCheckInterval = defaultReplicaCheckInterval
+	}
+	if c.TxMaxRetries == 0 {
+		c.TxMaxRetries = defaultTxMaxRetries
+	}
+	if c.TxRetryBackoff == 0 {
+		c.TxRetryBackoff = defaultTxRetryBackoff
+	}
+	client.primary = &replica{host: c.address(), role: "primary"}
+	if c.Mode != modeSQL && c.Mode != modePgxPool {
+		client.Init.Error = fmt.Errorf("unknown postgresql mode: %s", c.Mode)
+		store.PackageStore.Load(client)
+		return client
+	}
+	if c.MeterProvider == nil {
+		c.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := c.MeterProvider.Meter(meterName)
+	txRetries, err := meter.Int64Counter("db.client.transaction.retries",
+		metric.WithDescription("Transactions retried by WithTx after a serialization failure or a deadlock"))
+	if err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
+	client.txRetries = txRetries
 
-	db, err := otelsqlx.Connect(c.PgDriver, connectionString,
-		otelsql.WithAttributes(
-			semconv.DBSystemPostgreSQL,
-			attribute.KeyValue{Key: "driver", Value: attribute.StringSliceValue(sql.Drivers())},
-		),
-		otelsql.WithDBName(c.Database),
-		otelsql.WithMeterProvider(getMetricProvider()),
-	)
+	var db *sqlx.DB
+	if c.Mode == modePgxPool {
+		client.pool, db, err = c.openPool()
+	} else {
+		db, err = c.open("", 0, true)
+	}
 	client.Db = db
+	client.primary.db = db
 	if err != nil {
 		client.Init.Error = err
 		store.PackageStore.Load(client)
 		return client
 	}
-	db.SetMaxOpenConns(c.MaxIdleConnections)
+	if len(c.Replicas) > 0 {
+		replicas, err := c.openReplicas()
+		if err != nil {
+			client.Init.Error = err
+			store.PackageStore.Load(client)
+			return client
+		}
+		client.replicas = replicas
+		replicas.monitor(c.ReplicaCheckInterval, defaultTimeout, c.MaxReplicationLag)
+	}
+	if err := client.registerStats(meter); err != nil {
+		client.Init.Error = err
+		store.PackageStore.Load(client)
+		return client
+	}
+	if c.AutoMigrate {
+		if err := client.migrate(); err != nil {
+			client.Init.Error = err
+			store.PackageStore.Load(client)
+			return client
+		}
+	}
+	client.Ping(defaultTimeout, client.Live)
+	return client
+}
+
+// open connects to the configured hosts or to host when it is set, connect
+// pings it right away.
+func (c *Config) open(host string, port int, connect bool) (*sqlx.DB, error) {
+	connConfig, err := c.connConfig(host, port)
+	if err != nil {
+		return nil, err
+	}
+	connector := stdlib.GetConnector(*connConfig)
+	db := sqlx.NewDb(otelsql.OpenDB(connector,
+		otelsql.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			attribute.KeyValue{Key: "driver", Value: attribute.StringSliceValue(sql.Drivers())},
+			attribute.String("db.host", connConfig.Host),
+		),
+		otelsql.WithDBName(connConfig.Database),
+		otelsql.WithMeterProvider(c.MeterProvider),
+	), c.PgDriver)
+	db.SetMaxOpenConns(c.MaxOpenConnections)
 	db.SetConnMaxLifetime(c.ConnMaxLifetime)
 	db.SetMaxIdleConns(c.MaxIdleConnections)
 	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
-	client.Ping(defaultTimeout, client.Live)
-	return client
+	if connect {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
 }
@@ -0,0 +1,240 @@
+package postgresql
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// connConfig parses the connection settings into a pgx config. URL takes
+// precedence over the connection fields, only runtime params,
+// connect_timeout and query_exec_mode are applied on top of it. A non-empty
+// host is parsed in place of all hosts with its own TLS server name, it is
+// used for replicas: TargetSessionAttrs does not apply to them and port 0
+// keeps the port of the first host.
+func (c *Config) connConfig(host string, port int) (*pgx.ConnConfig, error) {
+	if _, err := c.queryExecMode(); err != nil {
+		return nil, err
+	}
+	var (
+		dsn string
+		err error
+	)
+	switch {
+	case c.URL == "":
+		dsn = c.keywordValue(host, port)
+	case host != "":
+		dsn, err = replicaDSN(c.URL, host, port)
+	default:
+		dsn = c.URL
+	}
+	if err != nil {
+		return nil, err
+	}
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if c.URL != "" {
+		if err := c.overrideURL(config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// replicaDSN points a URL or a keyword/value dsn at host alone and drops
+// target_session_attrs.
+func replicaDSN(dsn, host string, port int) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		// later keywords override earlier ones
+		replica := fmt.Sprintf("%s host='%s' target_session_attrs='any'", dsn, quoteReplacer.Replace(host))
+		if port != 0 {
+			replica += fmt.Sprintf(" port='%d'", port)
+		}
+		return replica, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		first, _, _ := strings.Cut(u.Host, ",")
+		_, port = splitHostPort(first, 0)
+	}
+	u.Host = host
+	if port != 0 {
+		u.Host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	query := u.Query()
+	query.Del("target_session_attrs")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// keywordValue builds a "keyword=value" connection string, values are quoted
+// and escaped so passwords may contain spaces and quotes. A non-empty host
+// replaces Host and Hosts as in connConfig.
+func (c *Config) keywordValue(host string, port int) string {
+	queryExecMode := c.QueryExecMode
+	if queryExecMode == "" {
+		queryExecMode = defaultQueryExecMode
+	}
+	hosts, ports := c.hostsAndPorts()
+	targetSessionAttrs := c.TargetSessionAttrs
+	if host != "" {
+		hosts, targetSessionAttrs = host, ""
+		if port != 0 {
+			ports = strconv.Itoa(port)
+		} else {
+			ports, _, _ = strings.Cut(ports, ",")
+		}
+	}
+	settings := [][2]string{
+		{"host", hosts},
+		{"port", ports},
+		{"user", c.Login},
+		{"password", c.Password},
+		{"dbname", c.Database},
+		{"sslmode", c.SSLMode},
+		{"default_query_exec_mode", queryExecMode},
+		{"target_session_attrs", targetSessionAttrs},
+	}
+	if c.ConnectTimeout > 0 {
+		// connect_timeout is in whole seconds and 0 disables it, so e.g.
+		// 500ms is rounded up to 1
+		seconds := int(math.Ceil(c.ConnectTimeout.Seconds()))
+		settings = append(settings, [2]string{"connect_timeout", strconv.Itoa(seconds)})
+	}
+	settings = append(settings, c.runtimeParams()...)
+
+	var builder strings.Builder
+	for _, setting := range settings {
+		if setting[1] == "" {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(setting[0])
+		builder.WriteString("='")
+		builder.WriteString(quoteReplacer.Replace(setting[1]))
+		builder.WriteByte('\'')
+	}
+	return builder.String()
+}
+
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// hostsAndPorts joins Hosts for a multi-host connection string, Host and Port
+// are used when Hosts is empty. Hosts without a port get Port, or 5432 when
+// only some of them have one, pgconn rejects empty entries.
+func (c *Config) hostsAndPorts() (string, string) {
+	if len(c.Hosts) == 0 {
+		if c.Port == 0 {
+			return c.Host, ""
+		}
+		return c.Host, strconv.Itoa(c.Port)
+	}
+	hosts := make([]string, 0, len(c.Hosts))
+	ports := make([]int, 0, len(c.Hosts))
+	for _, address := range c.Hosts {
+		host, port := splitHostPort(address, c.Port)
+		hosts = append(hosts, host)
+		ports = append(ports, port)
+	}
+	if !slices.ContainsFunc(ports, func(port int) bool { return port != 0 }) {
+		return strings.Join(hosts, ","), ""
+	}
+	joined := make([]string, len(ports))
+	for i, port := range ports {
+		if port == 0 {
+			port = defaultPort
+		}
+		joined[i] = strconv.Itoa(port)
+	}
+	return strings.Join(hosts, ","), strings.Join(joined, ",")
+}
+
+// runtimeParams are sent to the server in the startup message.
+func (c *Config) runtimeParams() [][2]string {
+	var params [][2]string
+	if c.ApplicationName != "" {
+		params = append(params, [2]string{"application_name", c.ApplicationName})
+	}
+	if c.SearchPath != "" {
+		params = append(params, [2]string{"search_path", c.SearchPath})
+	}
+	if c.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+	keys := make([]string, 0, len(c.RuntimeParams))
+	for key := range c.RuntimeParams {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		params = append(params, [2]string{key, c.RuntimeParams[key]})
+	}
+	return params
+}
+
+func (c *Config) overrideURL(config *pgx.ConnConfig) error {
+	for _, param := range c.runtimeParams() {
+		config.RuntimeParams[param[0]] = param[1]
+	}
+	if c.ConnectTimeout > 0 {
+		config.ConnectTimeout = c.ConnectTimeout
+	}
+	// the default applies to URL as well unless it sets the mode itself,
+	// migrations need simple_protocol for multi-statement scripts
+	if c.QueryExecMode != "" || !strings.Contains(c.URL, "default_query_exec_mode") {
+		mode, err := c.queryExecMode()
+		if err != nil {
+			return err
+		}
+		config.DefaultQueryExecMode = mode
+	}
+	return nil
+}
+
+// queryExecMode resolves QueryExecMode, empty means the default.
+func (c *Config) queryExecMode() (pgx.QueryExecMode, error) {
+	name := c.QueryExecMode
+	if name == "" {
+		name = defaultQueryExecMode
+	}
+	mode, ok := queryExecModes[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown postgresql query_exec_mode: %s", name)
+	}
+	return mode, nil
+}
+
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// address is how the primary is shown in Details.
+func (c *Config) address() string {
+	if c.URL != "" {
+		config, err := pgx.ParseConfig(c.URL)
+		if err != nil {
+			return ""
+		}
+		return net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))
+	}
+	if len(c.Hosts) > 0 {
+		return strings.Join(c.Hosts, ",")
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
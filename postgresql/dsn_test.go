@@ -0,0 +1,166 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+)
+
+type dsnHost struct {
+	host string
+	port uint16
+}
+
+func TestConnConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         Config
+		host           string
+		port           int
+		hosts          []dsnHost
+		password       string
+		connectTimeout time.Duration
+		serverName     string
+		queryExecMode  string
+		wantErr        bool
+	}{
+		{
+			name:     "password with spaces",
+			config:   Config{Host: "db", Port: 5432, Login: "user", SSLMode: "disable", Password: "p a s s"},
+			hosts:    []dsnHost{{"db", 5432}},
+			password: "p a s s",
+		},
+		{
+			name:     "password with quotes",
+			config:   Config{Host: "db", Port: 5432, Login: "user", SSLMode: "disable", Password: `it's "quoted"`},
+			hosts:    []dsnHost{{"db", 5432}},
+			password: `it's "quoted"`,
+		},
+		{
+			name:     "password with backslashes",
+			config:   Config{Host: "db", Port: 5432, Login: "user", SSLMode: "disable", Password: `a\b\'c\\`},
+			hosts:    []dsnHost{{"db", 5432}},
+			password: `a\b\'c\\`,
+		},
+		{
+			name:     "multi-host fields",
+			config:   Config{Hosts: []string{"a:5433", "b"}, Port: 5432, Login: "user", SSLMode: "disable", Password: "secret"},
+			hosts:    []dsnHost{{"a", 5433}, {"b", 5432}},
+			password: "secret",
+		},
+		{
+			name:   "multi-host fields without port",
+			config: Config{Hosts: []string{"a:5433", "b"}, Login: "user", SSLMode: "disable"},
+			hosts:  []dsnHost{{"a", 5433}, {"b", 5432}},
+		},
+		{
+			name:     "multi-host url",
+			config:   Config{URL: "postgres://user:p%20w%27d@a:5433,b:5434/db?sslmode=disable"},
+			hosts:    []dsnHost{{"a", 5433}, {"b", 5434}},
+			password: "p w'd",
+		},
+		{
+			name:     "replica keeps parsed port",
+			config:   Config{URL: "postgres://user:secret@a:5433,b:5434/db?sslmode=disable"},
+			host:     "replica",
+			hosts:    []dsnHost{{"replica", 5433}},
+			password: "secret",
+		},
+		{
+			name:   "replica overrides port",
+			config: Config{Hosts: []string{"a", "b"}, Port: 5432, Login: "user", SSLMode: "disable"},
+			host:   "replica",
+			port:   6432,
+			hosts:  []dsnHost{{"replica", 6432}},
+		},
+		{
+			name:       "replica verifies its own name",
+			config:     Config{URL: "postgres://user@a:5433/db?sslmode=verify-full&target_session_attrs=read-write"},
+			host:       "replica",
+			hosts:      []dsnHost{{"replica", 5433}},
+			serverName: "replica",
+		},
+		{
+			name:   "replica keeps prefer fallback",
+			config: Config{Host: "a", Port: 5432, Login: "user", SSLMode: "prefer", TargetSessionAttrs: "read-write"},
+			host:   "replica",
+			port:   6432,
+			hosts:  []dsnHost{{"replica", 6432}, {"replica", 6432}},
+		},
+		{
+			name:   "replica of keyword url",
+			config: Config{URL: "host=a port=5433 user=user sslmode=disable target_session_attrs=read-write"},
+			host:   "replica",
+			port:   6000,
+			hosts:  []dsnHost{{"replica", 6000}},
+		},
+		{
+			name:          "url uses default query exec mode",
+			config:        Config{URL: "postgres://user@db:5432/db?sslmode=disable"},
+			hosts:         []dsnHost{{"db", 5432}},
+			queryExecMode: defaultQueryExecMode,
+		},
+		{
+			name:          "url keeps its query exec mode",
+			config:        Config{URL: "postgres://user@db:5432/db?sslmode=disable&default_query_exec_mode=exec"},
+			hosts:         []dsnHost{{"db", 5432}},
+			queryExecMode: "exec",
+		},
+		{
+			name:           "connect timeout rounded up",
+			config:         Config{Host: "db", Port: 5432, Login: "user", SSLMode: "disable", ConnectTimeout: 500 * time.Millisecond},
+			hosts:          []dsnHost{{"db", 5432}},
+			connectTimeout: time.Second,
+		},
+		{
+			name:    "unknown query exec mode",
+			config:  Config{Host: "db", Port: 5432, Login: "user", SSLMode: "disable", QueryExecMode: "simple"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown query exec mode with url",
+			config:  Config{URL: "postgres://user@db:5432/db", QueryExecMode: "simple"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := test.config.connConfig(test.host, test.port)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts := []dsnHost{{config.Host, config.Port}}
+			for _, fallback := range config.Fallbacks {
+				hosts = append(hosts, dsnHost{fallback.Host, fallback.Port})
+			}
+			if len(hosts) != len(test.hosts) {
+				t.Fatalf("hosts = %v, expected %v", hosts, test.hosts)
+			}
+			for i := range hosts {
+				if hosts[i] != test.hosts[i] {
+					t.Fatalf("hosts = %v, expected %v", hosts, test.hosts)
+				}
+			}
+			if config.Password != test.password {
+				t.Errorf("password = %q, expected %q", config.Password, test.password)
+			}
+			if config.ConnectTimeout != test.connectTimeout {
+				t.Errorf("connect timeout = %s, expected %s", config.ConnectTimeout, test.connectTimeout)
+			}
+			if test.host != "" && config.ValidateConnect != nil {
+				t.Error("target_session_attrs is applied to a replica")
+			}
+			if test.serverName != "" && (config.TLSConfig == nil || config.TLSConfig.ServerName != test.serverName) {
+				t.Errorf("tls config = %+v, expected server name %s", config.TLSConfig, test.serverName)
+			}
+			if test.queryExecMode != "" && config.DefaultQueryExecMode != queryExecModes[test.queryExecMode] {
+				t.Errorf("query exec mode = %s, expected %s", config.DefaultQueryExecMode, test.queryExecMode)
+			}
+		})
+	}
+}
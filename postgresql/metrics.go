@@ -0,0 +1,61 @@
+package postgresql
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// registerStats reports pgxpool statistics under the names otelsql uses for
+// sql.DBStats, so dashboards work in both modes. The primary and the replicas
+// opened with otelsql already report them, in sql mode nothing is registered.
+func (c *Client) registerStats(meter metric.Meter) error {
+	if c.pool == nil {
+		return nil
+	}
+	open, err := meter.Int64ObservableGauge("go.sql.connections_open",
+		metric.WithDescription("The number of established connections both in use and idle"))
+	if err != nil {
+		return err
+	}
+	inUse, err := meter.Int64ObservableGauge("go.sql.connections_in_use",
+		metric.WithDescription("The number of connections currently in use"))
+	if err != nil {
+		return err
+	}
+	idle, err := meter.Int64ObservableGauge("go.sql.connections_idle",
+		metric.WithDescription("The number of idle connections"))
+	if err != nil {
+		return err
+	}
+	waitCount, err := meter.Int64ObservableCounter("go.sql.connections_wait_count",
+		metric.WithDescription("The total number of connections waited for"))
+	if err != nil {
+		return err
+	}
+	waitDuration, err := meter.Int64ObservableCounter("go.sql.connections_wait_duration",
+		metric.WithDescription("The total time blocked waiting for a new connection"),
+		metric.WithUnit("nanoseconds"))
+	if err != nil {
+		return err
+	}
+
+	attributes := metric.WithAttributes(
+		attribute.String("db.client.connection.pool.name", c.GetKey()),
+		attribute.String("db.host", c.primary.host),
+	)
+	registration, err := meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		stats := c.pool.Stat()
+		observer.ObserveInt64(open, int64(stats.TotalConns()), attributes)
+		observer.ObserveInt64(inUse, int64(stats.AcquiredConns()), attributes)
+		observer.ObserveInt64(idle, int64(stats.IdleConns()), attributes)
+		observer.ObserveInt64(waitCount, stats.EmptyAcquireCount(), attributes)
+		observer.ObserveInt64(waitDuration, int64(stats.EmptyAcquireWaitTime()), attributes)
+		return nil
+	}, open, inUse, idle, waitCount, waitDuration)
+	if err != nil {
+		return err
+	}
+	c.stats = registration
+	return nil
+}
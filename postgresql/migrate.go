@@ -0,0 +1,325 @@
+package postgresql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMigrationsTable = "schema_migrations"
+	upSuffix               = ".up.sql"
+	downSuffix             = ".down.sql"
+)
+
+// Migration is a pair of up/down scripts named "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql".
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type MigrationDetails struct {
+	Version int64  `json:"version"`
+	Applied int    `json:"applied"`
+	Pending int    `json:"pending"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Migrator applies migrations under a postgres advisory lock so only one
+// replica migrates at a time.
+type Migrator struct {
+	db         *sqlx.DB
+	table      string
+	lockKey    int64
+	migrations []Migration
+
+	mt   sync.Mutex
+	last MigrationDetails
+}
+
+func NewMigrator(db *sqlx.DB, table string, source fs.FS) (*Migrator, error) {
+	if table == "" {
+		table = defaultMigrationsTable
+	}
+	migrations, err := LoadMigrations(source)
+	if err != nil {
+		return nil, err
+	}
+	h := fnv.New64a()
+	h.Write([]byte(table))
+	return &Migrator{
+		db:         db,
+		table:      pgx.Identifier{table}.Sanitize(),
+		lockKey:    int64(h.Sum64()),
+		migrations: migrations,
+	}, nil
+}
+
+// LoadMigrations reads migrations from the root of source.
+func LoadMigrations(source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileName := entry.Name()
+		var (
+			up   bool
+			base string
+		)
+		switch {
+		case strings.HasSuffix(fileName, upSuffix):
+			up, base = true, strings.TrimSuffix(fileName, upSuffix)
+		case strings.HasSuffix(fileName, downSuffix):
+			base = strings.TrimSuffix(fileName, downSuffix)
+		default:
+			continue
+		}
+		versionPart, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", fileName, err)
+		}
+		data, err := fs.ReadFile(source, path.Clean(fileName))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, migration.Name, name)
+		}
+		if up {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	Version   int64     `db:"version"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if a, ok := applied[migration.Version]; ok {
+				if a.Checksum != migration.Checksum {
+					return fmt.Errorf("migration %d_%s checksum mismatch", migration.Version, migration.Name)
+				}
+				continue
+			}
+			err := m.exec(ctx, conn, migration.Up,
+				fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)", m.table),
+				migration.Version, migration.Name, migration.Checksum)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+			err := m.exec(ctx, conn, migration.Down,
+				fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table), migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var exists bool
+	if err := conn.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", m.table); err != nil {
+		return nil, err
+	}
+	applied := map[int64]appliedMigration{}
+	if exists {
+		applied, err = m.applied(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = &a.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) details() MigrationDetails {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return m.last
+}
+
+func (m *Migrator) refresh(ctx context.Context, migrateErr error) {
+	details := MigrationDetails{}
+	defer func() {
+		m.mt.Lock()
+		m.last = details
+		m.mt.Unlock()
+	}()
+	if migrateErr != nil {
+		details.Error = migrateErr.Error()
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		details.Error = err.Error()
+		return
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			details.Pending++
+			continue
+		}
+		details.Applied++
+		details.Version = status.Version
+	}
+}
+
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sqlx.Conn) error) (err error) {
+	defer func() {
+		m.refresh(ctx, err)
+	}()
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey)
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return f(conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version    BIGINT PRIMARY KEY,
+	name       TEXT        NOT NULL,
+	checksum   TEXT        NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, m.table))
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sqlx.Conn) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	err := conn.SelectContext(ctx, &rows, fmt.Sprintf("SELECT version, checksum, applied_at FROM %s", m.table))
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) exec(ctx context.Context, conn *sqlx.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Config) migrationSource() (fs.FS, error) {
+	if c.Migrations != nil {
+		return c.Migrations, nil
+	}
+	if c.MigrationsDir != "" {
+		return os.DirFS(c.MigrationsDir), nil
+	}
+	return nil, errors.New("auto_migrate requires migrations_dir or migrations")
+}
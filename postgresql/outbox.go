@@ -0,0 +1,502 @@
+package postgresql
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/ihatiko/go-chef-core-sdk/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	outboxKey           = "postgres-outbox"
+	defaultOutboxTable  = "outbox"
+	defaultOutboxBatch  = 100
+	defaultPollInterval = time.Second
+
+	defaultOutboxRetention   = 7 * 24 * time.Hour
+	defaultOutboxMaxAttempts = 10
+	defaultOutboxBackoff     = time.Second
+	outboxMaxBackoff         = 10 * time.Minute
+	// outboxClaimTimeout is how long claimed events are hidden from other
+	// relays, events of a relay that died are retried after it.
+	outboxClaimTimeout    = time.Minute
+	outboxCleanupInterval = time.Minute
+	outboxCleanupBatch    = 1000
+)
+
+// OutboxEvent is an event stored in the outbox table. Value is encoded as JSON.
+type OutboxEvent struct {
+	Topic   string
+	Key     string
+	Value   any
+	Headers map[string]string
+}
+
+// OutboxMessage is a stored event handed to the producer, Value holds JSON.
+type OutboxMessage struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// OutboxProducer publishes relayed events. failed maps indexes of messages
+// that were not produced to their errors, err fails the whole batch.
+//
+// A kafka client is adapted with:
+//
+//	postgresql.OutboxProducerFunc(func(ctx context.Context, messages []postgresql.OutboxMessage) (map[int]error, error) {
+//		batch := make([]kafka.Message, len(messages))
+//		for i, m := range messages {
+//			batch[i] = kafka.Message{Topic: m.Topic, Key: m.Key, Value: json.RawMessage(m.Value), Headers: m.Headers}
+//		}
+//		var produceError *kafka.ProduceError
+//		if err := producer.ProduceMessages(ctx, batch...); !errors.As(err, &produceError) {
+//			return nil, err
+//		}
+//		failed := map[int]error{}
+//		for _, e := range produceError.Errors {
+//			failed[e.Index] = e.Err
+//		}
+//		return failed, nil
+//	})
+type OutboxProducer interface {
+	Produce(ctx context.Context, messages []OutboxMessage) (failed map[int]error, err error)
+}
+
+type OutboxProducerFunc func(ctx context.Context, messages []OutboxMessage) (map[int]error, error)
+
+func (f OutboxProducerFunc) Produce(ctx context.Context, messages []OutboxMessage) (map[int]error, error) {
+	return f(ctx, messages)
+}
+
+type IOutbox interface {
+	Enqueue(ctx context.Context, tx *sqlx.Tx, events ...OutboxEvent) error
+}
+
+// Outbox stores events in the same transaction as business data and relays
+// them to a producer afterwards. Delivery is at-least-once: an event is marked
+// delivered only after the producer accepted it. Failed events are retried
+// with exponential backoff and marked dead after MaxAttempts, dead events are
+// kept until dead_at is reset.
+type Outbox struct {
+	types.Component
+	cfg        *OutboxConfig
+	db         *sqlx.DB
+	connConfig *pgx.ConnConfig
+	producer   OutboxProducer
+	table      string
+
+	cancel context.CancelFunc
+	wake   chan struct{}
+	wg     sync.WaitGroup
+
+	pending   atomic.Int64
+	oldest    atomic.Int64
+	dead      atomic.Int64
+	delivered atomic.Int64
+	failed    atomic.Int64
+	lastError atomic.Value
+}
+
+func (o *Outbox) GetKey() string {
+	if o.cfg.Name == "" {
+		return outboxKey
+	}
+	return outboxKey + "." + o.cfg.Name
+}
+
+type OutboxDetails struct {
+	Table     string        `json:"table"`
+	Pending   int64         `json:"pending"`
+	Lag       time.Duration `json:"lag"`
+	Dead      int64         `json:"dead"`
+	Delivered int64         `json:"delivered"`
+	Failed    int64         `json:"failed"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+func (o *Outbox) Details() any {
+	details := OutboxDetails{}
+	details.Table = o.cfg.Table
+	details.Pending = o.pending.Load()
+	details.Lag = time.Duration(o.oldest.Load())
+	details.Dead = o.dead.Load()
+	details.Delivered = o.delivered.Load()
+	details.Failed = o.failed.Load()
+	if lastError, ok := o.lastError.Load().(string); ok {
+		details.LastError = lastError
+	}
+	return details
+}
+
+func (o *Outbox) Live(ctx context.Context) error {
+	if o.db == nil {
+		return o.Init.Error
+	}
+	return o.db.PingContext(ctx)
+}
+
+func (o *Outbox) Shutdown() error {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	o.wg.Wait()
+	return nil
+}
+
+func (o *Outbox) Connection() IOutbox {
+	defer store.PackageStore.Load(o)
+	o.AwaitPing()
+	return o
+}
+
+// Enqueue inserts events using tx, they become visible to the relay once tx commits.
+func (o *Outbox) Enqueue(ctx context.Context, tx *sqlx.Tx, events ...OutboxEvent) error {
+	query := fmt.Sprintf("INSERT INTO %s (topic, key, payload, headers) VALUES ($1, $2, $3, $4)", o.table)
+	for _, event := range events {
+		payload, err := json.Marshal(event.Value)
+		if err != nil {
+			return err
+		}
+		headers, err := json.Marshal(event.Headers)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, event.Topic, event.Key, payload, headers); err != nil {
+			return err
+		}
+	}
+	if o.cfg.Notify && len(events) > 0 {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, '')", o.cfg.Channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *OutboxConfig) New(client *Client, producer OutboxProducer) *Outbox {
+	outbox := new(Outbox)
+	if c.Table == "" {
+		c.Table = defaultOutboxTable
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultOutboxBatch
+	}
+	if c.Channel == "" {
+		c.Channel = defaultOutboxTable
+	}
+	if c.Retention == 0 {
+		c.Retention = defaultOutboxRetention
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaultOutboxMaxAttempts
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = defaultOutboxBackoff
+	}
+	if c.Name == "" {
+		c.Name = client.cfg.Name
+	}
+	outbox.cfg = c
+	outbox.table = pgx.Identifier{c.Table}.Sanitize()
+	outbox.producer = producer
+	outbox.wake = make(chan struct{}, 1)
+	if client.Db == nil {
+		outbox.Init.Error = client.Init.Error
+		if outbox.Init.Error == nil {
+			outbox.Init.Error = errors.New("postgres client is not initialized")
+		}
+		store.PackageStore.Load(outbox)
+		return outbox
+	}
+	outbox.db = client.Db
+	if c.Notify {
+		connConfig, err := client.cfg.connConfig("", 0)
+		if err != nil {
+			outbox.Init.Error = err
+			store.PackageStore.Load(outbox)
+			return outbox
+		}
+		outbox.connConfig = connConfig
+	}
+	if c.CreateTable {
+		if err := outbox.createTable(); err != nil {
+			outbox.Init.Error = err
+			store.PackageStore.Load(outbox)
+			return outbox
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	outbox.cancel = cancel
+	outbox.wg.Add(1)
+	go outbox.relay(ctx)
+	if c.Notify {
+		outbox.wg.Add(1)
+		go outbox.listen(ctx)
+	}
+	outbox.Ping(defaultTimeout, outbox.Live)
+	return outbox
+}
+
+func (o *Outbox) createTable() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	_, err := o.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id              BIGSERIAL PRIMARY KEY,
+	topic           TEXT        NOT NULL,
+	key             TEXT        NOT NULL DEFAULT '',
+	payload         BYTEA       NOT NULL,
+	headers         JSONB       NOT NULL DEFAULT '{}',
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	delivered_at    TIMESTAMPTZ,
+	dead_at         TIMESTAMPTZ,
+	attempts        INT         NOT NULL DEFAULT 0,
+	last_error      TEXT
+)`, o.table))
+	if err != nil {
+		return err
+	}
+	// keeps the relay and the lag query proportional to pending events
+	_, err = o.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s ON %s (next_attempt_at) WHERE delivered_at IS NULL AND dead_at IS NULL",
+		pgx.Identifier{o.cfg.Table + "_undelivered_idx"}.Sanitize(), o.table))
+	if err != nil {
+		return err
+	}
+	_, err = o.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s ON %s (delivered_at) WHERE delivered_at IS NOT NULL",
+		pgx.Identifier{o.cfg.Table + "_delivered_idx"}.Sanitize(), o.table))
+	return err
+}
+
+func (o *Outbox) relay(ctx context.Context) {
+	defer o.wg.Done()
+	ticker := time.NewTicker(o.cfg.PollInterval)
+	defer ticker.Stop()
+	var cleaned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		for {
+			count, err := o.relayBatch(ctx)
+			if err != nil {
+				o.lastError.Store(err.Error())
+				break
+			}
+			if count < o.cfg.BatchSize {
+				break
+			}
+		}
+		if err := o.updateLag(ctx); err != nil {
+			o.lastError.Store(err.Error())
+		}
+		if o.cfg.Retention > 0 && time.Since(cleaned) >= outboxCleanupInterval {
+			if err := o.cleanup(ctx); err != nil {
+				o.lastError.Store(err.Error())
+			}
+			cleaned = time.Now()
+		}
+	}
+}
+
+// cleanup deletes events delivered longer than Retention ago in batches, so
+// a large backlog does not hold a long transaction.
+func (o *Outbox) cleanup(ctx context.Context) error {
+	query := fmt.Sprintf(
+		"DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE delivered_at < $1 LIMIT $2)",
+		o.table)
+	before := time.Now().Add(-o.cfg.Retention)
+	for {
+		result, err := o.db.ExecContext(ctx, query, before, outboxCleanupBatch)
+		if err != nil {
+			return err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil || deleted < outboxCleanupBatch {
+			return err
+		}
+	}
+}
+
+type outboxRow struct {
+	Id       int64  `db:"id"`
+	Topic    string `db:"topic"`
+	Key      string `db:"key"`
+	Payload  []byte `db:"payload"`
+	Headers  []byte `db:"headers"`
+	Attempts int    `db:"attempts"`
+}
+
+// relayBatch claims due events by moving their next_attempt_at past
+// outboxClaimTimeout, so no transaction is open while they are produced.
+func (o *Outbox) relayBatch(ctx context.Context) (int, error) {
+	var rows []outboxRow
+	err := o.db.SelectContext(ctx, &rows, fmt.Sprintf(`UPDATE %[1]s SET next_attempt_at = now() + make_interval(secs => $2)
+WHERE id IN (
+	SELECT id FROM %[1]s
+	WHERE delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()
+	ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED)
+RETURNING id, topic, key, payload, headers, attempts`, o.table),
+		o.cfg.BatchSize, outboxClaimTimeout.Seconds())
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	slices.SortFunc(rows, func(a, b outboxRow) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	messages := make([]OutboxMessage, len(rows))
+	for i, row := range rows {
+		var headers map[string]string
+		if err := json.Unmarshal(row.Headers, &headers); err != nil {
+			return 0, err
+		}
+		messages[i] = OutboxMessage{
+			Topic:   row.Topic,
+			Key:     row.Key,
+			Value:   row.Payload,
+			Headers: headers,
+		}
+	}
+
+	// the claim must outlive producing, otherwise another relay sends the
+	// same events again
+	produceCtx, cancel := context.WithTimeout(ctx, outboxClaimTimeout/2)
+	failed, produceErr := o.producer.Produce(produceCtx, messages)
+	cancel()
+	if produceErr != nil {
+		failed = make(map[int]error, len(rows))
+		for i := range rows {
+			failed[i] = produceErr
+		}
+	}
+
+	delivered := make([]int64, 0, len(rows))
+	for i, row := range rows {
+		if failedErr, ok := failed[i]; ok {
+			if err := o.retry(ctx, row, failedErr); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		delivered = append(delivered, row.Id)
+	}
+	if len(delivered) > 0 {
+		_, err := o.db.ExecContext(ctx, fmt.Sprintf(
+			"UPDATE %s SET delivered_at = now(), attempts = attempts + 1, last_error = NULL WHERE id = ANY($1)", o.table),
+			delivered)
+		if err != nil {
+			return 0, err
+		}
+	}
+	o.delivered.Add(int64(len(delivered)))
+	o.failed.Add(int64(len(failed)))
+	switch {
+	case produceErr != nil:
+		return 0, produceErr
+	case len(failed) > 0:
+		return 0, fmt.Errorf("outbox: %d of %d events failed", len(failed), len(rows))
+	}
+	return len(rows), nil
+}
+
+// retry schedules the next attempt of row with exponential backoff, the
+// event is marked dead once it reaches MaxAttempts.
+func (o *Outbox) retry(ctx context.Context, row outboxRow, failedErr error) error {
+	backoff := outboxMaxBackoff
+	if row.Attempts < 32 {
+		backoff = min(o.cfg.RetryBackoff<<row.Attempts, outboxMaxBackoff)
+	}
+	_, err := o.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET
+	attempts = attempts + 1,
+	last_error = $2,
+	next_attempt_at = now() + make_interval(secs => $3),
+	dead_at = CASE WHEN attempts + 1 >= $4 THEN now() END
+WHERE id = $1`, o.table), row.Id, failedErr.Error(), backoff.Seconds(), o.cfg.MaxAttempts)
+	return err
+}
+
+func (o *Outbox) updateLag(ctx context.Context) error {
+	var (
+		pending int64
+		dead    int64
+		oldest  sql.NullTime
+	)
+	err := o.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT
+	count(*) FILTER (WHERE dead_at IS NULL),
+	count(*) FILTER (WHERE dead_at IS NOT NULL),
+	min(created_at) FILTER (WHERE dead_at IS NULL)
+FROM %s WHERE delivered_at IS NULL`, o.table)).
+		Scan(&pending, &dead, &oldest)
+	if err != nil {
+		return err
+	}
+	o.pending.Store(pending)
+	o.dead.Store(dead)
+	if oldest.Valid {
+		o.oldest.Store(int64(time.Since(oldest.Time)))
+	} else {
+		o.oldest.Store(0)
+	}
+	return nil
+}
+
+// listen holds a dedicated connection subscribed to the notify channel and
+// wakes the relay on every notification.
+func (o *Outbox) listen(ctx context.Context) {
+	defer o.wg.Done()
+	for {
+		err := o.waitNotifications(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			o.lastError.Store(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.cfg.PollInterval):
+		}
+	}
+}
+
+func (o *Outbox) waitNotifications(ctx context.Context) error {
+	connectCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	conn, err := pgx.ConnectConfig(connectCtx, o.connConfig)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{o.cfg.Channel}.Sanitize()); err != nil {
+		return err
+	}
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		select {
+		case o.wake <- struct{}{}:
+		default:
+		}
+	}
+}
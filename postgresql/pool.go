@@ -0,0 +1,57 @@
+package postgresql
+
+import (
+	"context"
+	"github.com/exaring/otelpgx"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	modeSQL     = "sql"
+	modePgxPool = "pgxpool"
+)
+
+// Pool returns the native pgx pool for COPY, batches and binary codecs. It is
+// nil unless Mode is pgxpool.
+func (c *Client) Pool() *pgxpool.Pool {
+	defer store.PackageStore.Load(c)
+	c.AwaitPing()
+	return c.pool
+}
+
+// openPool builds a pgx pool traced with OpenTelemetry. The returned sqlx.DB
+// borrows connections from the pool, so migrations, the outbox and the sqlx
+// helpers keep working. MaxIdleConnections has no pgxpool counterpart, idle
+// connections are limited by ConnMaxIdleTime.
+func (c *Config) openPool() (*pgxpool.Pool, *sqlx.DB, error) {
+	connConfig, err := c.connConfig("", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	connConfig.Tracer = otelpgx.NewTracer(otelpgx.WithMeterProvider(c.MeterProvider))
+
+	// NewWithConfig only accepts a config created by ParseConfig
+	poolConfig, err := pgxpool.ParseConfig("")
+	if err != nil {
+		return nil, nil, err
+	}
+	poolConfig.ConnConfig = connConfig
+	poolConfig.MaxConns = int32(c.MaxOpenConnections)
+	poolConfig.MaxConnLifetime = c.ConnMaxLifetime
+	poolConfig.MaxConnIdleTime = c.ConnMaxIdleTime
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	return pool, sqlx.NewDb(stdlib.OpenDBFromPool(pool), c.PgDriver), nil
+}
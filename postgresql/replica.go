@@ -0,0 +1,299 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	balancerRoundRobin   = "round_robin"
+	balancerLeastLatency = "least_latency"
+
+	defaultReplicaCheckInterval = 5 * time.Second
+)
+
+// replicationLagQuery returns zero when the replica replayed everything it
+// received, otherwise the age of the last replayed transaction. It is null
+// on a primary.
+const replicationLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN NULL
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+type routeKey struct{}
+
+const (
+	routeReplica = iota + 1
+	routePrimary
+)
+
+// WithReadOnly marks ctx so that Client.DB routes it to a replica.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeKey{}, routeReplica)
+}
+
+// WithPrimary marks ctx so that read helpers of Client use the primary, e.g.
+// to read what was just written.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeKey{}, routePrimary)
+}
+
+func routeOf(ctx context.Context) int {
+	route, _ := ctx.Value(routeKey{}).(int)
+	return route
+}
+
+// NodeDetails is the health of a node seen by the last replica check.
+type NodeDetails struct {
+	Host    string        `json:"host"`
+	Role    string        `json:"role"`
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Lag     time.Duration `json:"lag,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type replica struct {
+	host    string
+	role    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+	latency atomic.Int64
+	lag     atomic.Int64
+	err     atomic.Value
+}
+
+func (r *replica) details() NodeDetails {
+	details := NodeDetails{
+		Host:    r.host,
+		Role:    r.role,
+		Healthy: r.healthy.Load(),
+		Latency: time.Duration(r.latency.Load()),
+		Lag:     time.Duration(r.lag.Load()),
+	}
+	if err, ok := r.err.Load().(string); ok {
+		details.Error = err
+	}
+	return details
+}
+
+// check pings the replica and ejects it when it is down or lags behind more
+// than maxLag.
+func (r *replica) check(ctx context.Context, timeout, maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	var lag sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, replicationLagQuery).Scan(&lag)
+	latency := time.Since(start)
+	switch {
+	case err != nil:
+	case !lag.Valid:
+		err = errors.New("node is not in recovery")
+	default:
+		r.lag.Store(int64(lag.Float64 * float64(time.Second)))
+		if maxLag > 0 && time.Duration(r.lag.Load()) > maxLag {
+			err = errors.New("replication lag exceeds max_replication_lag")
+		}
+	}
+	r.record(latency, err)
+}
+
+func (r *replica) record(latency time.Duration, err error) {
+	r.latency.Store(int64(latency))
+	if err != nil {
+		r.err.Store(err.Error())
+		r.healthy.Store(false)
+		return
+	}
+	r.err.Store("")
+	r.healthy.Store(true)
+}
+
+type replicaSet struct {
+	nodes    []*replica
+	balancer string
+	next     atomic.Uint64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// pick returns a healthy replica or nil when all of them are ejected.
+func (s *replicaSet) pick() *sqlx.DB {
+	var chosen *replica
+	switch s.balancer {
+	case balancerLeastLatency:
+		for _, node := range s.nodes {
+			if !node.healthy.Load() {
+				continue
+			}
+			if chosen == nil || node.latency.Load() < chosen.latency.Load() {
+				chosen = node
+			}
+		}
+	default:
+		start := s.next.Add(1)
+		for i := range s.nodes {
+			node := s.nodes[(start+uint64(i))%uint64(len(s.nodes))]
+			if node.healthy.Load() {
+				chosen = node
+				break
+			}
+		}
+	}
+	if chosen == nil {
+		return nil
+	}
+	return chosen.db
+}
+
+func (s *replicaSet) monitor(interval, timeout, maxLag time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.checkAll(ctx, timeout, maxLag)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.checkAll(ctx, timeout, maxLag)
+			}
+		}
+	}()
+}
+
+func (s *replicaSet) checkAll(ctx context.Context, timeout, maxLag time.Duration) {
+	var wg sync.WaitGroup
+	for _, node := range s.nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.check(ctx, timeout, maxLag)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *replicaSet) close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	var errs []error
+	for _, node := range s.nodes {
+		errs = append(errs, node.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// openReplicas connects lazily, so a replica that is down on start joins the
+// set as soon as a check succeeds.
+func (c *Config) openReplicas() (*replicaSet, error) {
+	set := &replicaSet{balancer: c.ReplicaBalancer}
+	primary, err := c.connConfig("", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range c.Replicas {
+		// the port of the primary, also when it comes from URL
+		host, port := splitHostPort(address, int(primary.Port))
+		db, err := c.open(host, port, false)
+		if err != nil {
+			_ = set.close()
+			return nil, err
+		}
+		set.nodes = append(set.nodes, &replica{
+			host: net.JoinHostPort(host, strconv.Itoa(port)),
+			role: "replica",
+			db:   db,
+		})
+	}
+	return set, nil
+}
+
+func splitHostPort(address string, defaultPort int) (string, int) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, defaultPort
+	}
+	value, err := strconv.Atoi(port)
+	if err != nil {
+		return address, defaultPort
+	}
+	return host, value
+}
+
+// DB returns a replica for contexts marked by WithReadOnly and the primary
+// otherwise.
+func (c *Client) DB(ctx context.Context) *sqlx.DB {
+	if routeOf(ctx) == routeReplica {
+		return c.Reader()
+	}
+	return c.Db
+}
+
+// Reader returns a healthy replica, or the primary when there are no
+// replicas or all of them are ejected.
+func (c *Client) Reader() *sqlx.DB {
+	if c.replicas != nil {
+		if db := c.replicas.pick(); db != nil {
+			return db
+		}
+	}
+	return c.Db
+}
+
+func (c *Client) reader(ctx context.Context) *sqlx.DB {
+	if routeOf(ctx) == routePrimary {
+		return c.Db
+	}
+	return c.Reader()
+}
+
+// GetContext runs a read-only query on a replica unless ctx is marked by
+// WithPrimary.
+func (c *Client) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return c.reader(ctx).GetContext(ctx, dest, query, args...)
+}
+
+// SelectContext runs a read-only query on a replica unless ctx is marked by
+// WithPrimary.
+func (c *Client) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return c.reader(ctx).SelectContext(ctx, dest, query, args...)
+}
+
+// QueryxContext runs a read-only query on a replica unless ctx is marked by
+// WithPrimary.
+func (c *Client) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	return c.reader(ctx).QueryxContext(ctx, query, args...)
+}
+
+// ExecContext always runs on the primary.
+func (c *Client) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.Db.ExecContext(ctx, query, args...)
+}
+
+func (c *Client) nodes() []NodeDetails {
+	if c.replicas == nil {
+		return nil
+	}
+	nodes := []NodeDetails{c.primary.details()}
+	for _, node := range c.replicas.nodes {
+		nodes = append(nodes, node.details())
+	}
+	return nodes
+}
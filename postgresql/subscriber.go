@@ -0,0 +1,285 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"github.com/ihatiko/go-chef-core-sdk/store"
+	"github.com/ihatiko/go-chef-core-sdk/types"
+	"github.com/jackc/pgx/v5"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	subscriberKey             = "postgres-subscriber"
+	defaultReconnectInterval  = time.Second
+	defaultSubscriberBuffer   = 100
+	maxSubscriberReconnectGap = 30 * time.Second
+)
+
+// Notification is a payload sent with NOTIFY or pg_notify.
+type Notification struct {
+	Channel string
+	Payload string
+	PID     uint32
+}
+
+type NotificationHandler func(ctx context.Context, notification Notification)
+
+type ISubscriber interface {
+	Notifications() <-chan Notification
+	Handle(channel string, handler NotificationHandler)
+	OnReconnect(handler func(ctx context.Context))
+}
+
+// Subscriber holds a dedicated connection listening to the configured
+// channels. Notifications sent while it reconnects are lost, use OnReconnect
+// to resync, e.g. to drop a cache.
+type Subscriber struct {
+	types.Component
+	cfg        *SubscriberConfig
+	connConfig *pgx.ConnConfig
+
+	mt          sync.RWMutex
+	handlers    map[string][]NotificationHandler
+	reconnected []func(ctx context.Context)
+	out         chan Notification
+	closed      bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	connected    atomic.Bool
+	reconnects   atomic.Int64
+	received     atomic.Int64
+	dropped      atomic.Int64
+	lastReceived atomic.Int64
+	lastError    atomic.Value
+}
+
+func (s *Subscriber) GetKey() string {
+	if s.cfg.Name == "" {
+		return subscriberKey
+	}
+	return subscriberKey + "." + s.cfg.Name
+}
+
+type SubscriberDetails struct {
+	Channels         []string  `json:"channels"`
+	Connected        bool      `json:"connected"`
+	Reconnects       int64     `json:"reconnects"`
+	Received         int64     `json:"received"`
+	Dropped          int64     `json:"dropped"`
+	LastNotification time.Time `json:"last_notification,omitempty"`
+	LastError        string    `json:"last_error,omitempty"`
+}
+
+func (s *Subscriber) Details() any {
+	details := SubscriberDetails{}
+	details.Channels = s.cfg.Channels
+	details.Connected = s.connected.Load()
+	details.Reconnects = s.reconnects.Load()
+	details.Received = s.received.Load()
+	details.Dropped = s.dropped.Load()
+	if lastReceived := s.lastReceived.Load(); lastReceived > 0 {
+		details.LastNotification = time.Unix(0, lastReceived)
+	}
+	if lastError, ok := s.lastError.Load().(string); ok {
+		details.LastError = lastError
+	}
+	return details
+}
+
+func (s *Subscriber) Live(_ context.Context) error {
+	if s.connConfig == nil {
+		return s.Init.Error
+	}
+	if s.connected.Load() {
+		return nil
+	}
+	if lastError, ok := s.lastError.Load().(string); ok && lastError != "" {
+		return errors.New(lastError)
+	}
+	return errors.New("subscriber is not connected")
+}
+
+func (s *Subscriber) Shutdown() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	// nothing is dispatched anymore, range loops over Notifications end
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	if s.out != nil && !s.closed {
+		close(s.out)
+	}
+	s.closed = true
+	return nil
+}
+
+func (s *Subscriber) Connection() ISubscriber {
+	defer store.PackageStore.Load(s)
+	s.AwaitPing()
+	return s
+}
+
+// Notifications returns a channel with notifications of all channels. When
+// it is full new notifications are dropped and counted in Details. It is
+// closed by Shutdown.
+func (s *Subscriber) Notifications() <-chan Notification {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	if s.out == nil {
+		s.out = make(chan Notification, s.cfg.Buffer)
+		if s.closed {
+			close(s.out)
+		}
+	}
+	return s.out
+}
+
+// Handle calls handler for every notification of channel, handlers run one
+// at a time in the order notifications arrive.
+func (s *Subscriber) Handle(channel string, handler NotificationHandler) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	s.handlers[channel] = append(s.handlers[channel], handler)
+}
+
+// OnReconnect calls handler every time the subscription is restored after
+// the connection was lost.
+func (s *Subscriber) OnReconnect(handler func(ctx context.Context)) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+	s.reconnected = append(s.reconnected, handler)
+}
+
+func (c *SubscriberConfig) New(client *Client) *Subscriber {
+	subscriber := new(Subscriber)
+	if c.ReconnectInterval == 0 {
+		c.ReconnectInterval = defaultReconnectInterval
+	}
+	if c.Buffer == 0 {
+		c.Buffer = defaultSubscriberBuffer
+	}
+	if c.Name == "" {
+		c.Name = client.cfg.Name
+	}
+	subscriber.cfg = c
+	subscriber.handlers = map[string][]NotificationHandler{}
+	if client.Db == nil {
+		subscriber.Init.Error = client.Init.Error
+		if subscriber.Init.Error == nil {
+			subscriber.Init.Error = errors.New("postgres client is not initialized")
+		}
+		store.PackageStore.Load(subscriber)
+		return subscriber
+	}
+	if len(c.Channels) == 0 {
+		subscriber.Init.Error = errors.New("subscriber requires at least one channel")
+		store.PackageStore.Load(subscriber)
+		return subscriber
+	}
+	connConfig, err := client.cfg.connConfig("", 0)
+	if err != nil {
+		subscriber.Init.Error = err
+		store.PackageStore.Load(subscriber)
+		return subscriber
+	}
+	subscriber.connConfig = connConfig
+	ctx, cancel := context.WithCancel(context.Background())
+	subscriber.cancel = cancel
+	subscriber.wg.Add(1)
+	go subscriber.listen(ctx)
+	subscriber.Ping(defaultTimeout, subscriber.Live)
+	return subscriber
+}
+
+// listen keeps the subscription alive, the wait between reconnects doubles
+// up to 30s and resets once a connection succeeds.
+func (s *Subscriber) listen(ctx context.Context) {
+	defer s.wg.Done()
+	wait := s.cfg.ReconnectInterval
+	reconnect := false
+	for {
+		subscribed, err := s.subscribe(ctx, reconnect)
+		s.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.lastError.Store(err.Error())
+		}
+		if subscribed {
+			reconnect = true
+			wait = s.cfg.ReconnectInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxSubscriberReconnectGap)
+	}
+}
+
+// subscribe connects, listens to all channels and dispatches notifications
+// until the connection fails. It reports whether the channels were listened.
+func (s *Subscriber) subscribe(ctx context.Context, reconnect bool) (bool, error) {
+	connectCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	conn, err := pgx.ConnectConfig(connectCtx, s.connConfig)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+	for _, channel := range s.cfg.Channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return false, err
+		}
+	}
+	s.connected.Store(true)
+	s.lastError.Store("")
+	if reconnect {
+		s.reconnects.Add(1)
+		s.mt.RLock()
+		handlers := s.reconnected
+		s.mt.RUnlock()
+		for _, handler := range handlers {
+			handler(ctx)
+		}
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		s.dispatch(ctx, Notification{
+			Channel: notification.Channel,
+			Payload: notification.Payload,
+			PID:     notification.PID,
+		})
+	}
+}
+
+func (s *Subscriber) dispatch(ctx context.Context, notification Notification) {
+	s.received.Add(1)
+	s.lastReceived.Store(time.Now().UnixNano())
+	s.mt.RLock()
+	handlers := s.handlers[notification.Channel]
+	out := s.out
+	s.mt.RUnlock()
+	for _, handler := range handlers {
+		handler(ctx, notification)
+	}
+	if out == nil {
+		return
+	}
+	select {
+	case out <- notification:
+	default:
+		s.dropped.Add(1)
+	}
+}
@@ -0,0 +1,147 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultTxMaxRetries   = 3
+	defaultTxRetryBackoff = 20 * time.Millisecond
+	maxTxRetryBackoff     = time.Second
+
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// TxOptions configures WithTx. Isolation and ReadOnly are ignored by nested
+// calls, they run in a savepoint of the outer transaction.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries overrides Config.TxMaxRetries, a negative value disables
+	// retries.
+	MaxRetries int
+}
+
+type TxFunc func(ctx context.Context, tx *sqlx.Tx) error
+
+type txKey struct{}
+
+type txState struct {
+	tx    *sqlx.Tx
+	depth int
+}
+
+// TxFromContext returns the transaction started by WithTx.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
+// WithTx runs fn in a transaction on the primary, commits when it returns
+// nil and rolls back on an error or a panic. The whole transaction is retried
+// with backoff on serialization failures (40001) and deadlocks (40P01), so fn
+// must not have side effects outside of the database. A WithTx called with a
+// ctx passed to fn runs in a savepoint and is rolled back to it on an error.
+func (c *Client) WithTx(ctx context.Context, opts *TxOptions, fn TxFunc) error {
+	if c.Db == nil {
+		return c.Init.Error
+	}
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return c.savepoint(ctx, state, fn)
+	}
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = c.cfg.TxMaxRetries
+	}
+	backoff := c.cfg.TxRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.runTx(ctx, opts, fn)
+		code, retryable := retryableSQLState(err)
+		if !retryable || attempt >= maxRetries {
+			return err
+		}
+		c.txRetries.Add(ctx, 1, metric.WithAttributes(attribute.String("db.response.status_code", code)))
+		// full jitter keeps competing transactions from retrying in lockstep
+		wait := rand.N(backoff) + 1
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, maxTxRetryBackoff)
+	}
+}
+
+func (c *Client) runTx(ctx context.Context, opts *TxOptions, fn TxFunc) (err error) {
+	tx, err := c.Db.BeginTxx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_ = tx.Rollback()
+			panic(recovered)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err := fn(context.WithValue(ctx, txKey{}, &txState{tx: tx}), tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Client) savepoint(ctx context.Context, state *txState, fn TxFunc) (err error) {
+	nested := &txState{tx: state.tx, depth: state.depth + 1}
+	name := fmt.Sprintf("sp_%d", nested.depth)
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_, _ = state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(recovered)
+		}
+		if err != nil {
+			// serialization failures abort the whole transaction, the outer
+			// WithTx retries it
+			if _, rollbackErr := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+		}
+	}()
+	if err := fn(context.WithValue(ctx, txKey{}, nested), state.tx); err != nil {
+		return err
+	}
+	_, err = state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+func retryableSQLState(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return "", false
+	}
+	switch pgErr.Code {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return pgErr.Code, true
+	}
+	return "", false
+}
@@ -2,8 +2,13 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/ihatiko/go-chef-core-sdk/store"
 	"github.com/ihatiko/go-chef-core-sdk/types"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/extra/redisotel/v9"
@@ -22,40 +27,169 @@ const (
 	key = "redis"
 )
 
+const (
+	modeSingle   = "single"
+	modeSentinel = "sentinel"
+	modeCluster  = "cluster"
+	modeRing     = "ring"
+)
+
 type Client struct {
 	types.Component
-	Db  *redis.Client
-	cfg *Config
+	Db   redis.UniversalClient
+	cfg  *Config
+	mode string
+
+	// shards ping every RingHosts address, the ring itself skips shards it
+	// already marked down
+	shards map[string]*redis.Client
+
+	mt    sync.Mutex
+	nodes []NodeDetails
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.cfg.Name == "" {
+		return key
+	}
+	return key + "." + c.cfg.Name
 }
 
 type Details struct {
-	Host          string   `json:"host,omitempty"`
-	Database      int      `toml:"database,omitempty"`
-	SentinelHosts []string `toml:"sentinel_hosts,omitempty"`
-	MasterName    string   `toml:"master_name,omitempty"`
+	Name          string            `json:"name,omitempty"`
+	Host          string            `json:"host,omitempty"`
+	Database      int               `toml:"database,omitempty"`
+	SentinelHosts []string          `toml:"sentinel_hosts,omitempty"`
+	MasterName    string            `toml:"master_name,omitempty"`
+	Mode          string            `json:"mode"`
+	ClusterHosts  []string          `json:"cluster_hosts,omitempty"`
+	RingHosts     map[string]string `json:"ring_hosts,omitempty"`
+	Nodes         []NodeDetails     `json:"nodes,omitempty"`
+}
+
+// NodeDetails is a cluster node or a ring shard seen by the last health check.
+type NodeDetails struct {
+	Name     string   `json:"name,omitempty"`
+	Addr     string   `json:"addr"`
+	Slots    string   `json:"slots,omitempty"`
+	Replicas []string `json:"replicas,omitempty"`
+	Error    string   `json:"error,omitempty"`
 }
 
 func (c *Client) Details() any {
 	details := Details{}
+	details.Name = c.cfg.Name
 	details.MasterName = c.cfg.MasterName
 	details.Host = c.cfg.Host
 	details.Database = c.cfg.Database
 	details.SentinelHosts = c.cfg.SentinelHosts
+	details.Mode = c.mode
+	details.ClusterHosts = c.cfg.ClusterHosts
+	details.RingHosts = c.cfg.RingHosts
+	c.mt.Lock()
+	details.Nodes = c.nodes
+	c.mt.Unlock()
 	return details
 }
 
 func (c *Client) Shutdown() error {
-	return c.Db.Close()
+	errs := []error{c.Db.Close()}
+	for _, shard := range c.shards {
+		errs = append(errs, shard.Close())
+	}
+	return errors.Join(errs...)
 }
 
 func (c *Client) Live(ctx context.Context) error {
-	return c.Db.Ping(ctx).Err()
+	switch db := c.Db.(type) {
+	case *redis.ClusterClient:
+		return c.liveCluster(ctx, db)
+	case *redis.Ring:
+		return c.liveRing(ctx)
+	default:
+		return c.Db.Ping(ctx).Err()
+	}
+}
+
+// liveCluster pings every master and refreshes the topology shown in Details.
+func (c *Client) liveCluster(ctx context.Context, db *redis.ClusterClient) error {
+	slots, err := db.ClusterSlots(ctx).Result()
+	if err != nil {
+		return err
+	}
+	nodes := make([]NodeDetails, 0, len(slots))
+	index := map[string]int{}
+	for _, slot := range slots {
+		if len(slot.Nodes) == 0 {
+			continue
+		}
+		addr := slot.Nodes[0].Addr
+		i, ok := index[addr]
+		if !ok {
+			i = len(nodes)
+			index[addr] = i
+			node := NodeDetails{Addr: addr}
+			for _, replica := range slot.Nodes[1:] {
+				node.Replicas = append(node.Replicas, replica.Addr)
+			}
+			nodes = append(nodes, node)
+		}
+		slotRange := fmt.Sprintf("%d-%d", slot.Start, slot.End)
+		if nodes[i].Slots != "" {
+			slotRange = nodes[i].Slots + "," + slotRange
+		}
+		nodes[i].Slots = slotRange
+	}
+	mt := sync.Mutex{}
+	err = db.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		err := master.Ping(ctx).Err()
+		if err != nil {
+			mt.Lock()
+			if i, ok := index[master.Options().Addr]; ok {
+				nodes[i].Error = err.Error()
+			}
+			mt.Unlock()
+		}
+		return err
+	})
+	c.mt.Lock()
+	c.nodes = nodes
+	c.mt.Unlock()
+	return err
 }
-func (c *Client) Connection() *redis.Client {
+
+// liveRing pings every configured shard and reports each of them in Details.
+func (c *Client) liveRing(ctx context.Context) error {
+	nodes := make([]NodeDetails, 0, len(c.shards))
+	errs := make([]error, 0, len(c.shards))
+	mt := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for name, shard := range c.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node := NodeDetails{Name: name, Addr: shard.Options().Addr}
+			err := shard.Ping(ctx).Err()
+			mt.Lock()
+			defer mt.Unlock()
+			if err != nil {
+				node.Error = err.Error()
+				errs = append(errs, fmt.Errorf("shard %s: %w", name, err))
+			}
+			nodes = append(nodes, node)
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(nodes, func(a, b NodeDetails) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	c.mt.Lock()
+	c.nodes = nodes
+	c.mt.Unlock()
+	return errors.Join(errs...)
+}
+
+func (c *Client) Connection() redis.UniversalClient {
 	defer store.PackageStore.Load(c)
 	c.AwaitPing()
 	return c.Db
@@ -82,7 +216,47 @@ func (c *Config) New() *Client {
 	if c.MaxIdleConnections == 0 {
 		c.MaxIdleConnections = defaultMaxIdleConnections
 	}
-	if len(c.SentinelHosts) > 0 {
+	switch {
+	case len(c.ClusterHosts) > 0:
+		client.mode = modeCluster
+		client.Db = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           c.ClusterHosts,
+			Username:        c.Login,
+			Password:        c.Password,
+			ReadOnly:        c.ReadOnly,
+			WriteTimeout:    c.WriteTimeout,
+			ReadTimeout:     c.ReadTimeout,
+			ConnMaxIdleTime: c.ConnMaxIdleTime,
+			ConnMaxLifetime: c.ConnMaxLifetime,
+			MaxIdleConns:    c.MaxIdleConnections,
+		})
+	case len(c.RingHosts) > 0:
+		client.mode = modeRing
+		client.Db = redis.NewRing(&redis.RingOptions{
+			Addrs:           c.RingHosts,
+			Username:        c.Login,
+			Password:        c.Password,
+			DB:              c.Database,
+			WriteTimeout:    c.WriteTimeout,
+			ReadTimeout:     c.ReadTimeout,
+			ConnMaxIdleTime: c.ConnMaxIdleTime,
+			ConnMaxLifetime: c.ConnMaxLifetime,
+			MaxIdleConns:    c.MaxIdleConnections,
+		})
+		client.shards = make(map[string]*redis.Client, len(c.RingHosts))
+		for name, addr := range c.RingHosts {
+			client.shards[name] = redis.NewClient(&redis.Options{
+				Addr:         addr,
+				Username:     c.Login,
+				Password:     c.Password,
+				DB:           c.Database,
+				WriteTimeout: c.WriteTimeout,
+				ReadTimeout:  c.ReadTimeout,
+				MaxIdleConns: 1,
+			})
+		}
+	case len(c.SentinelHosts) > 0:
+		client.mode = modeSentinel
 		client.Db = redis.NewFailoverClient(&redis.FailoverOptions{
 			MasterName:      c.MasterName,
 			SentinelAddrs:   c.SentinelHosts,
@@ -93,7 +267,8 @@ func (c *Config) New() *Client {
 			ConnMaxLifetime: c.ConnMaxLifetime,
 			MaxIdleConns:    c.MaxIdleConnections,
 		})
-	} else {
+	default:
+		client.mode = modeSingle
 		client.Db = redis.NewClient(&redis.Options{
 			Addr:            c.Host,
 			Password:        c.Password,
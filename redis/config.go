@@ -3,6 +3,8 @@ package redis
 import "time"
 
 type Config struct {
+	Name string `toml:"name"`
+
 	Host               string        `toml:"host"`
 	Login              string        `toml:"login"`
 	Password           string        `toml:"password"`
@@ -16,4 +18,25 @@ type Config struct {
 	ConnMaxIdleTime    time.Duration `toml:"conn_max_idle_time"`
 	ConnMaxLifetime    time.Duration `toml:"conn_max_lifetime"`
 	MaxIdleConnections int           `toml:"max_idle_connections"`
+
+	// ClusterHosts are seed addresses of a Redis Cluster.
+	ClusterHosts []string `toml:"cluster_hosts"`
+	// ReadOnly enables read-only commands on cluster replicas.
+	ReadOnly bool `toml:"read_only"`
+	// RingHosts is a map of shard name to address of a sharded (ring) setup.
+	RingHosts map[string]string `toml:"ring_hosts"`
+}
+
+// Configs is a deployment per named table, e.g. [redis.cache].
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
 }
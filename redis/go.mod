@@ -3,6 +3,7 @@ module github.com/ihatiko/go-chef-clients-providers/redis
 go 1.23.4
 
 require (
+	github.com/ihatiko/go-chef-clients-providers/lock v0.0.1
 	github.com/ihatiko/go-chef-core-sdk v0.0.1
 	github.com/redis/go-redis/extra/redisotel/v9 v9.7.0
 	github.com/redis/go-redis/v9 v9.7.0
@@ -21,3 +22,5 @@ require (
 	go.opentelemetry.io/otel/trace v1.34.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 )
+
+replace github.com/ihatiko/go-chef-clients-providers/lock v0.0.1 => ../lock
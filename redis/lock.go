@@ -0,0 +1,155 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ihatiko/go-chef-clients-providers/lock"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	lockPrefix  = "lock:"
+	fenceSuffix = ":fence"
+)
+
+var (
+	refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+// Locker returns a lock.Locker on a single redis instance.
+func (c *Client) Locker() lock.Locker {
+	return NewRedlock(c.Db)
+}
+
+// Redlock implements the Redlock algorithm: a lock is held when it is taken on
+// the majority of independent instances within its ttl. With one instance it is
+// a plain SET NX lock fenced by an INCR counter. Counters of independent
+// instances do not grow across quorums, so with several instances Token is 0.
+type Redlock struct {
+	clients []redis.UniversalClient
+	// DriftFactor compensates clock drift between instances.
+	DriftFactor float64
+}
+
+func NewRedlock(clients ...redis.UniversalClient) *Redlock {
+	return &Redlock{
+		clients:     clients,
+		DriftFactor: 0.01,
+	}
+}
+
+type redisLock struct {
+	locker *Redlock
+	key    string
+	// redisKey is key with lockPrefix, used in redis commands only
+	redisKey string
+	value    string
+	token    int64
+}
+
+func (r *Redlock) quorum() int {
+	return len(r.clients)/2 + 1
+}
+
+func (r *Redlock) Acquire(ctx context.Context, key string, ttl time.Duration) (lock.Lock, error) {
+	if len(r.clients) == 0 {
+		return nil, errors.New("redlock: no redis clients")
+	}
+	value, err := randomValue()
+	if err != nil {
+		return nil, err
+	}
+	l := &redisLock{locker: r, key: key, redisKey: lockPrefix + key, value: value}
+	start := time.Now()
+	acquired := 0
+	for _, client := range r.clients {
+		ok, err := client.SetNX(ctx, l.redisKey, value, ttl).Result()
+		if err == nil && ok {
+			acquired++
+		}
+	}
+	drift := time.Duration(float64(ttl)*r.DriftFactor) + 2*time.Millisecond
+	if acquired >= r.quorum() && time.Since(start)+drift < ttl {
+		if len(r.clients) > 1 {
+			return l, nil
+		}
+		token, err := r.clients[0].Incr(ctx, l.redisKey+fenceSuffix).Result()
+		if err == nil {
+			l.token = token
+			return l, nil
+		}
+		_ = l.release(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	_ = l.release(context.WithoutCancel(ctx))
+	return nil, lock.ErrNotAcquired
+}
+
+func (l *redisLock) Key() string {
+	return l.key
+}
+
+// Token is 0 when the lock is held on several instances, Redlock cannot
+// provide a fencing token.
+func (l *redisLock) Token() int64 {
+	return l.token
+}
+
+func (l *redisLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	refreshed := 0
+	for _, client := range l.locker.clients {
+		result, err := refreshScript.Run(ctx, client, []string{l.redisKey}, l.value, ttl.Milliseconds()).Int64()
+		if err == nil && result == 1 {
+			refreshed++
+		}
+	}
+	if refreshed < l.locker.quorum() {
+		return lock.ErrLockLost
+	}
+	return nil
+}
+
+func (l *redisLock) Release(ctx context.Context) error {
+	return l.release(ctx)
+}
+
+func (l *redisLock) release(ctx context.Context) error {
+	var errs []error
+	released := 0
+	for _, client := range l.locker.clients {
+		result, err := releaseScript.Run(ctx, client, []string{l.redisKey}, l.value).Int64()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		released += int(result)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("redis lock release: %w", errors.Join(errs...))
+	}
+	if released < l.locker.quorum() {
+		return lock.ErrLockLost
+	}
+	return nil
+}
+
+func randomValue() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
@@ -20,15 +20,19 @@ type Client struct {
 }
 
 func (c *Client) GetKey() string {
-	return key
+	if c.config.Name == "" {
+		return key
+	}
+	return key + "." + c.config.Name
 }
 
 type Details struct {
+	Name string `json:"name,omitempty"`
 	Host string `json:"host"`
 }
 
 func (c *Client) Details() any {
-	details := Details{Host: c.config.Host}
+	details := Details{Name: c.config.Name, Host: c.config.Host}
 	return details
 }
 
@@ -3,6 +3,8 @@ package s3
 import "time"
 
 type Config struct {
+	Name string `toml:"name"`
+
 	Host          string        `toml:"host"`
 	Login         string        `toml:"login"`
 	Password      string        `toml:"password"`
@@ -11,3 +13,17 @@ type Config struct {
 	MaxRetries    int           `toml:"max_retries"`
 	HealthTimeout time.Duration `toml:"health_timeout"`
 }
+
+// Configs is an endpoint per named table, e.g. [s3.media].
+type Configs map[string]Config
+
+func (c Configs) New() map[string]*Client {
+	clients := make(map[string]*Client, len(c))
+	for name, config := range c {
+		if config.Name == "" {
+			config.Name = name
+		}
+		clients[name] = config.New()
+	}
+	return clients
+}